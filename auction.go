@@ -0,0 +1,297 @@
+package orderbook
+
+import (
+	"sync/atomic"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// Equilibrium is the outcome of uncrossing the book at a single price
+type Equilibrium struct {
+	Price  decimal.Decimal
+	Volume decimal.Decimal // quantity executed at Price
+
+	// Imbalance is the quantity on Side that would be left unexecuted at Price
+	Imbalance decimal.Decimal
+	Side      SideType
+}
+
+// Equilibrium returns the indicative price and volume at which the book would
+// be uncrossed now. ok is false if nothing would be executed. Legs of fired
+// OCO groups and AoN orders do not take part in an uncross and are left out.
+//
+// The price is chosen among the prices of the resting limit orders. It is the
+// one that executes the largest volume, then the one that leaves the smallest
+// imbalance. If several prices remain and all of them leave a surplus on the
+// same side, the highest price is chosen for a buy surplus and the lowest for
+// a sell surplus, otherwise the one closest to the last price. If only market
+// orders are crossed they are executed at the last price.
+func (ob *OrderBook) Equilibrium() (eq Equilibrium, ok bool) {
+	var low, high, closest Equilibrium
+	var buySurplus, sellSurplus bool
+
+	// Market orders execute at any price
+	bidVol := auctionQty(&ob.marketBids)
+	for q := ob.bids.GetQueue(); q != nil; q = ob.bids.GetNextQueue(q.Price()) {
+		bidVol = bidVol.Add(auctionQty(q))
+	}
+	below, asksAt := decimal.Zero, auctionQty(&ob.marketAsks)
+
+	bi, ai := ob.bids.priceTree.Iterator(), ob.asks.priceTree.Iterator()
+	bok, aok := bi.Next(), ai.Next()
+
+	for bok || aok {
+		var p decimal.Decimal
+		switch {
+		case bok && aok:
+			p = bi.Key()
+			if ai.Key().LessThan(p) {
+				p = ai.Key()
+			}
+		case bok:
+			p = bi.Key()
+		default:
+			p = ai.Key()
+		}
+
+		for aok && ai.Key().LessThanOrEqual(p) {
+			asksAt = asksAt.Add(auctionQty(ai.Value()))
+			aok = ai.Next()
+		}
+
+		demand := bidVol.Sub(below)
+		for bok && bi.Key().Equal(p) {
+			below = below.Add(auctionQty(bi.Value()))
+			bok = bi.Next()
+		}
+
+		c := equilibriumAt(p, demand, asksAt)
+		if c.Volume.IsZero() {
+			continue
+		}
+
+		switch {
+		case !ok || c.Volume.GreaterThan(low.Volume) || (c.Volume.Equal(low.Volume) && c.Imbalance.LessThan(low.Imbalance)):
+			ok = true
+			low, high, closest = c, c, c
+			buySurplus = !c.Imbalance.IsZero() && c.Side == Buy
+			sellSurplus = !c.Imbalance.IsZero() && c.Side == Sell
+		case c.Volume.Equal(low.Volume) && c.Imbalance.Equal(low.Imbalance):
+			high = c
+			buySurplus = buySurplus && !c.Imbalance.IsZero() && c.Side == Buy
+			sellSurplus = sellSurplus && !c.Imbalance.IsZero() && c.Side == Sell
+			if priceDistance(p, ob.lastPrice).LessThan(priceDistance(closest.Price, ob.lastPrice)) {
+				closest = c
+			}
+		}
+	}
+
+	if !ok {
+		// Only market orders can be crossed
+		if ob.lastPrice.IsZero() {
+			return Equilibrium{}, false
+		}
+
+		eq = equilibriumAt(ob.lastPrice, bidVol.Sub(below), asksAt)
+		return eq, !eq.Volume.IsZero()
+	}
+
+	switch {
+	case buySurplus:
+		return high, true
+	case sellSurplus:
+		return low, true
+	default:
+		return closest, true
+	}
+}
+
+// equilibriumAt returns the outcome of uncrossing demand against supply at p
+func equilibriumAt(p, demand, supply decimal.Decimal) Equilibrium {
+	if demand.GreaterThan(supply) {
+		return Equilibrium{Price: p, Volume: supply, Imbalance: demand.Sub(supply), Side: Buy}
+	}
+	return Equilibrium{Price: p, Volume: demand, Imbalance: supply.Sub(demand), Side: Sell}
+}
+
+func priceDistance(a, b decimal.Decimal) decimal.Decimal {
+	if a.GreaterThan(b) {
+		return a.Sub(b)
+	}
+	return b.Sub(a)
+}
+
+// Uncross ends the call auction. The crossed part of the book is executed at
+// the single price returned by Equilibrium, unexecuted market orders are
+// canceled and the book moves on to Continuous, or to Closed from the
+// ClosingAuction. Uncross does nothing unless the book is in OpeningAuction,
+// ClosingAuction or VolatilityAuction.
+//
+// Orders trade in price-time priority; each trade reports the bid as maker and
+// the ask as taker.
+func (ob *OrderBook) Uncross(tok uint64) Equilibrium {
+	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
+		panic("invalid token received: cannot maintain determinism")
+	}
+	if ob.journal != nil {
+		ob.journal.uncross(tok)
+	}
+
+	if !ob.state.auction() {
+		return Equilibrium{}
+	}
+
+	to := Continuous
+	if ob.state == ClosingAuction {
+		to = Closed
+	}
+	ob.collar.tripped = false
+	return ob.uncross(to)
+}
+
+// uncross executes the book at its equilibrium price and moves it to state.
+// Orders triggered by the uncross are matched in Continuous; a Closed book
+// does not match, so they are collected while the auction still runs and
+// their market orders are canceled with the others.
+func (ob *OrderBook) uncross(state SessionState) Equilibrium {
+	lp := ob.lastPrice
+	eq, ok := ob.Equilibrium()
+	if ok {
+		ob.executeAt(eq.Price)
+	}
+
+	ob.cancelMarketOrders()
+	if state == Closed {
+		ob.postProcess(lp)
+		ob.cancelMarketOrders()
+		ob.changeState(state)
+	} else {
+		ob.changeState(state)
+		ob.postProcess(lp)
+	}
+
+	return eq
+}
+
+// executeAt matches every bid priced at or above price against every ask
+// priced at or below it, all at price
+func (ob *OrderBook) executeAt(price decimal.Decimal) {
+	for {
+		bid := ob.auctionHead(Buy, price)
+		ask := ob.auctionHead(Sell, price)
+		if bid == nil || ask == nil {
+			return
+		}
+
+		qty := bid.Qty
+		if ask.Qty.LessThan(qty) {
+			qty = ask.Qty
+		}
+		bidLeaves, askLeaves := bid.Qty.Sub(qty), ask.Qty.Sub(qty)
+
+		bidStatus := ob.auctionFill(bid, bidLeaves)
+		askStatus := ob.auctionFill(ask, askLeaves)
+		ob.putTradeAt(bid, ask, bidStatus, askStatus, qty, bidLeaves, askLeaves, price)
+		ob.fireGroups(bid, ask)
+
+		if bidLeaves.IsZero() {
+			ob.filled(bid)
+			ob.release(bid)
+		}
+		if askLeaves.IsZero() {
+			ob.filled(ask)
+			ob.release(ask)
+		}
+	}
+}
+
+// auctionFill reduces a resting order to leaves, keeping its position in the
+// queue, or removes it from the book once it is filled entirely
+func (ob *OrderBook) auctionFill(o *Order, leaves decimal.Decimal) OrderStatus {
+	if leaves.IsZero() {
+		ob.cancelOrder(o.ID)
+		return FilledComplete
+	}
+
+	ob.updateQty(o, leaves)
+	return FilledPartial
+}
+
+// auctionHead returns the first order on side in price-time priority that
+// takes part in an uncross at price. Market orders come first.
+func (ob *OrderBook) auctionHead(side SideType, price decimal.Decimal) *Order {
+	if o := auctionFirst(ob.marketQueue(side)); o != nil {
+		return o
+	}
+
+	pl, eligible := ob.bids, price.LessThanOrEqual
+	if side == Sell {
+		pl, eligible = ob.asks, price.GreaterThanOrEqual
+	}
+
+	for q := pl.GetQueue(); q != nil && eligible(q.Price()); q = pl.GetNextQueue(q.Price()) {
+		if o := auctionFirst(q); o != nil {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// auctionFirst returns the first order of q that takes part in an uncross.
+// Legs of fired OCO groups and AoN orders are skipped.
+func auctionFirst(q *orderQueue) *Order {
+	for o := q.Head(); o != nil; o = o.next {
+		if !o.canceled && o.Flag&AoN == 0 {
+			return o
+		}
+	}
+	return nil
+}
+
+// auctionQty returns the quantity of the orders of q that take part in an
+// uncross, skipping the same orders as auctionFirst
+func auctionQty(q *orderQueue) decimal.Decimal {
+	qty := decimal.Zero
+	for o := q.Head(); o != nil; o = o.next {
+		if !o.canceled && o.Flag&AoN == 0 {
+			qty = qty.Add(o.Qty)
+		}
+	}
+	return qty
+}
+
+// marketQueue returns the market orders resting on side during an auction.
+// They are kept out of the price levels since they have no price.
+func (ob *OrderBook) marketQueue(side SideType) *orderQueue {
+	if side == Buy {
+		return &ob.marketBids
+	}
+	return &ob.marketAsks
+}
+
+// restAuction adds an order to the book without matching it. Market orders
+// rest ahead of every limit order on their side.
+func (ob *OrderBook) restAuction(o *Order) {
+	o.refresh()
+	switch {
+	case o.Class == Market:
+		ob.orders.put(o.ID, ob.marketQueue(o.Side).Append(o))
+	case o.Side == Buy:
+		ob.orders.put(o.ID, ob.bids.Append(o))
+	default:
+		ob.orders.put(o.ID, ob.asks.Append(o))
+	}
+	ob.trackExpiry(o)
+}
+
+// cancelMarketOrders cancels the market orders left after an uncross
+func (ob *OrderBook) cancelMarketOrders() {
+	for _, q := range []*orderQueue{&ob.marketBids, &ob.marketAsks} {
+		for q.Head() != nil {
+			o := ob.cancelOrder(q.Head().ID)
+			ob.putOrder(MsgCancelOrder, Canceled, o, o.Qty, decimal.Zero, ReasonIoC, nil)
+			ob.release(o)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package orderbook
+
+import (
+	"bytes"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getAuctionOrderBook() (*Notification, *OrderBook) {
+	tok = 1
+	n := &Notification{}
+	return n, NewOrderBook(n, WithAuction(true))
+}
+
+func uncross(ob *OrderBook) Equilibrium {
+	eq := ob.Uncross(tok)
+	tok++
+	return eq
+}
+
+func TestAuction_OrdersRest(t *testing.T) {
+	n, ob := getAuctionOrderBook()
+
+	processLine(ob, "1	L	B	2	100	0	N")
+	processLine(ob, "2	L	S	1	90	0	N")
+	processLine(ob, "3	M	B	1	0	0	N")
+	processLine(ob, "4	M	S	1	0	0	N")
+	processLine(ob, "5	L	S	1	80	0	P")
+	processLine(ob, "6	L	S	1	90	0	I")
+	processLine(ob, "7	L	S	1	90	0	F")
+	processLine(ob, "8	L	S	1	90	0	A")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"CreateOrder Accepted 2 1",
+		"CreateOrder Accepted 3 1",
+		"CreateOrder Accepted 4 1",
+		"CreateOrder Accepted 5 1",
+		"CreateOrder Rejected 6 1 ErrSessionState",
+		"CreateOrder Rejected 7 1 ErrSessionState",
+		"CreateOrder Rejected 8 1 ErrSessionState",
+	})
+	assert.Equal(t, decimal.New(80, 0), ob.Order(5).Price)
+
+	// Market orders rest outside of the price levels and keep a zero price
+	assert.Equal(t, uint64(1), ob.bids.Len())
+	assert.Equal(t, uint64(2), ob.asks.Len())
+	assert.Equal(t, uint64(1), ob.marketBids.Len())
+	assert.Equal(t, uint64(1), ob.marketAsks.Len())
+	assert.True(t, ob.Order(3).Price.IsZero())
+	assert.Equal(t, decimal.New(100, 0), ob.bids.MaxPriceQueue().Price())
+	assert.Equal(t, decimal.New(80, 0), ob.asks.MinPriceQueue().Price())
+	assert.Equal(t, []*Order{ob.Order(1)}, ob.bids.Orders())
+}
+
+func TestAuction_Equilibrium(t *testing.T) {
+	n, ob := getAuctionOrderBook()
+
+	_, ok := ob.Equilibrium()
+	assert.False(t, ok)
+
+	processLine(ob, "1	L	B	3	102	0	N")
+	processLine(ob, "2	L	B	2	101	0	N")
+	processLine(ob, "3	L	S	2	100	0	N")
+	processLine(ob, "4	L	S	2	101	0	N")
+	processLine(ob, "5	L	S	5	103	0	N")
+
+	eq, ok := ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, Equilibrium{
+		Price:     decimal.New(101, 0),
+		Volume:    decimal.New(4, 0),
+		Imbalance: decimal.New(1, 0),
+		Side:      Buy,
+	}, eq)
+
+	n.Reset()
+	assert.Equal(t, eq, uncross(ob))
+	n.Verify(t, []string{
+		"1 3 FilledPartial FilledComplete 2 101",
+		"1 4 FilledComplete FilledPartial 1 101",
+		"2 4 FilledPartial FilledComplete 1 101",
+	})
+	assert.Equal(t, decimal.New(101, 0), ob.lastPrice)
+
+	// The book matches continuously after the uncross
+	n.Reset()
+	processLine(ob, "6	L	S	2	101	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 6 2",
+		"2 6 FilledComplete FilledPartial 1 101",
+	})
+	assert.Equal(t, decimal.New(101, 0), ob.asks.MinPriceQueue().Price())
+}
+
+func TestAuction_EquilibriumSurplus(t *testing.T) {
+	// A buy surplus picks the highest of the equally good prices
+	_, ob := getAuctionOrderBook()
+	processLine(ob, "1	L	B	3	105	0	N")
+	processLine(ob, "2	L	S	2	100	0	N")
+
+	eq, ok := ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, decimal.New(105, 0), eq.Price)
+	assert.Equal(t, Buy, eq.Side)
+
+	// A sell surplus picks the lowest
+	_, ob = getAuctionOrderBook()
+	processLine(ob, "1	L	B	2	105	0	N")
+	processLine(ob, "2	L	S	3	100	0	N")
+
+	eq, ok = ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, decimal.New(100, 0), eq.Price)
+	assert.Equal(t, Sell, eq.Side)
+
+	// Without a surplus the price closest to the last price is picked
+	_, ob = getAuctionOrderBook()
+	ob.lastPrice = decimal.New(104, 0)
+	processLine(ob, "1	L	B	2	105	0	N")
+	processLine(ob, "2	L	S	2	100	0	N")
+
+	eq, ok = ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, decimal.New(105, 0), eq.Price)
+	assert.True(t, eq.Imbalance.IsZero())
+}
+
+func TestAuction_MarketOrders(t *testing.T) {
+	n, ob := getAuctionOrderBook()
+
+	processLine(ob, "1	M	B	4	0	0	N")
+	processLine(ob, "2	L	S	1	100	0	N")
+	processLine(ob, "3	L	S	2	110	0	N")
+	processLine(ob, "4	L	B	1	90	0	N")
+
+	eq, ok := ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, decimal.New(110, 0), eq.Price)
+	assert.Equal(t, decimal.New(3, 0), eq.Volume)
+
+	n.Reset()
+	uncross(ob)
+	n.Verify(t, []string{
+		"1 2 FilledPartial FilledComplete 1 110",
+		"1 3 FilledPartial FilledComplete 2 110",
+		"CancelOrder Canceled 1 1",
+	})
+	assert.Nil(t, ob.Order(1))
+	assert.Equal(t, decimal.New(90, 0), ob.bids.MaxPriceQueue().Price())
+
+	assert.Equal(t, Continuous, ob.State())
+
+	// Uncross outside of an auction only consumes the token
+	n.Reset()
+	assert.Equal(t, Equilibrium{}, uncross(ob))
+	n.Verify(t, []string{})
+}
+
+func TestAuction_MarketOrderIDs(t *testing.T) {
+	n, ob := getAuctionOrderBook()
+
+	// Market orders rest in an auction, so they may not take a live id
+	processLine(ob, "1	L	B	1	100	0	N")
+	processLine(ob, "1	M	B	1	0	0	N")
+	processLine(ob, "2	M	B	1	0	200	SL")
+	processLine(ob, "2	M	S	1	0	0	N")
+	addLinkedOrder(ob, 3, Limit, Sell, 1, 120, 0, None, 0, 1)
+	processLine(ob, "3	M	S	1	0	0	N")
+	processLine(ob, "4	M	B	2	0	0	N")
+	processLine(ob, "5	L	S	5	90	0	N")
+
+	// A market order keeps its zero price when its quantity is modified
+	ob.ModifyOrder(tok, 4, decimal.New(1, 0), decimal.Zero)
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 1",
+		"CreateOrder Rejected 1 0 ErrOrderExists",
+		"CreateOrder Accepted 2 1",
+		"CreateOrder Rejected 2 0 ErrOrderExists",
+		"CreateOrder Accepted 3 1",
+		"CreateOrder Rejected 3 0 ErrOrderExists",
+		"CreateOrder Accepted 4 2",
+		"CreateOrder Accepted 5 5",
+		"ModifyOrder Accepted 4 1",
+	})
+
+	n.Reset()
+	require.NoError(t, setState(ob, Continuous))
+	n.Verify(t, []string{
+		"4 5 FilledComplete FilledPartial 1 90",
+		"1 5 FilledComplete FilledPartial 1 90",
+	})
+	assert.Equal(t, decimal.New(120, 0), ob.Order(3).Price)
+	assert.Equal(t, uint64(1), ob.triggerOver.Len())
+}
+
+// getAoNAuctionOrderBook returns a book in the OpeningAuction with an AoN bid
+// for 5 at 100 that rested before the auction started
+func getAoNAuctionOrderBook() (*Notification, *OrderBook) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "3	L	B	5	100	0	A")
+	setState(ob, Halted)
+	setState(ob, OpeningAuction)
+	return n, ob
+}
+
+func TestAuction_SkipsAoN(t *testing.T) {
+	n, ob := getAoNAuctionOrderBook()
+	processLine(ob, "1	L	B	1	100	0	N")
+	processLine(ob, "2	L	S	1	100	0	N")
+
+	n.Reset()
+	uncross(ob)
+	n.Verify(t, []string{
+		"1 2 FilledComplete FilledComplete 1 100",
+	})
+	assert.NotNil(t, ob.Order(3))
+}
+
+func TestAuction_EquilibriumSkipsAoN(t *testing.T) {
+	n, ob := getAoNAuctionOrderBook()
+	processLine(ob, "1	L	B	1	101	0	N")
+	processLine(ob, "2	L	S	2	100	0	N")
+	processLine(ob, "4	L	S	1	101	0	N")
+
+	// The AoN bid at the equilibrium price adds no volume
+	eq, ok := ob.Equilibrium()
+	require.True(t, ok)
+	assert.Equal(t, Equilibrium{
+		Price:     decimal.New(100, 0),
+		Volume:    decimal.New(1, 0),
+		Imbalance: decimal.New(1, 0),
+		Side:      Sell,
+	}, eq)
+
+	n.Reset()
+	assert.Equal(t, eq, uncross(ob))
+	n.Verify(t, []string{
+		"1 2 FilledComplete FilledPartial 1 100",
+	})
+	assert.NotNil(t, ob.Order(3))
+}
+
+func TestAuction_Snapshot(t *testing.T) {
+	n, ob := getAuctionOrderBook()
+	processLine(ob, "1	L	B	2	100	0	N")
+	processLine(ob, "2	L	S	1	90	0	N")
+	processLine(ob, "3	M	S	2	0	0	N")
+
+	var snap bytes.Buffer
+	require.NoError(t, ob.Snapshot(&snap))
+
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(&snap, rn)
+	require.NoError(t, err)
+	assert.Equal(t, OpeningAuction, rob.State())
+
+	n.Reset()
+	ob.Uncross(tok)
+	rob.Uncross(tok)
+	assert.Equal(t, n.Strings(), rn.Strings())
+	assert.Equal(t, ob.StateHash(), rob.StateHash())
+}
+
+func TestAuction_Journal(t *testing.T) {
+	var journal bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithAuction(true), WithJournal(j))
+	processLine(ob, "1	L	B	2	100	0	N")
+	processLine(ob, "2	L	S	1	90	0	N")
+	processLine(ob, "3	M	B	2	0	0	N")
+	uncross(ob)
+	processLine(ob, "4	L	S	1	100	0	N")
+	require.NoError(t, j.Flush())
+
+	rn := &Notification{}
+	rob := NewOrderBook(rn, WithAuction(true))
+	require.NoError(t, Replay(&journal, rob))
+
+	require.NotEmpty(t, n.Strings())
+	assert.Equal(t, n.Strings(), rn.Strings())
+	assert.Equal(t, ob.StateHash(), rob.StateHash())
+}
@@ -0,0 +1,230 @@
+package orderbook
+
+import (
+	"sync/atomic"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// Band limits the prices at which an incoming order can match to Offset either
+// side of a reference price. With Percent, Offset is a fraction of the
+// reference price, e.g. 0.05 for 5%. Band edges are rounded inwards to the tick
+// size of the instrument.
+type Band struct {
+	Offset  decimal.Decimal
+	Percent bool
+}
+
+// edge returns the furthest price side can match at around ref
+func (b Band) edge(side SideType, ref decimal.Decimal) decimal.Decimal {
+	offset := b.Offset
+	if b.Percent {
+		offset = ref.Mul(offset)
+	}
+
+	if side == Buy {
+		return ref.Add(offset)
+	}
+
+	if offset.GreaterThanOrEqual(ref) {
+		return decimal.Zero
+	}
+	return ref.Sub(offset)
+}
+
+// CollarAction selects what happens to the remainder of an order whose
+// matching was stopped at the edge of a price band or whose limit price is
+// beyond it. Resting orders outside of a band are canceled when an incoming
+// order would trade with them.
+type CollarAction byte
+
+const (
+	// CollarCancel cancels the remainder
+	CollarCancel CollarAction = iota
+	// CollarRest rests the remainder as a limit order at the band edge
+	CollarRest
+)
+
+// String implements fmt.Stringer interface
+func (a CollarAction) String() string {
+	switch a {
+	case CollarRest:
+		return "Rest"
+	default:
+		return "Cancel"
+	}
+}
+
+type bandKind byte
+
+const (
+	bandNone bandKind = iota
+	bandStatic
+	bandDynamic
+)
+
+// collar holds the price bands of the book and the state of its circuit
+// breaker
+type collar struct {
+	reference decimal.Decimal // reference price of the static band
+	static    Band
+	dynamic   Band // around the last price
+	action    CollarAction
+
+	haltTokens uint64 // length of a volatility auction
+	haltTime   int64
+
+	tripped    bool // the book is in a volatility auction started by the breaker
+	untilToken uint64
+	untilTime  int64
+}
+
+// edge returns the narrowest band edge for an order on side given the last
+// price lp, and which band it belongs to
+func (c *collar) edge(side SideType, lp decimal.Decimal) (edge decimal.Decimal, band bandKind) {
+	if !c.reference.IsZero() && !c.static.Offset.IsZero() {
+		edge, band = c.static.edge(side, c.reference), bandStatic
+	}
+
+	if !lp.IsZero() && !c.dynamic.Offset.IsZero() {
+		d := c.dynamic.edge(side, lp)
+		if band == bandNone || (side == Buy && d.LessThan(edge)) || (side == Sell && d.GreaterThan(edge)) {
+			edge, band = d, bandDynamic
+		}
+	}
+
+	return
+}
+
+// SetReferencePrice moves the reference price of the static band, e.g. to the
+// closing price of the previous session. Resting orders left outside of the
+// band are canceled when an incoming order would trade with them. A zero price
+// disables the static band.
+func (ob *OrderBook) SetReferencePrice(tok uint64, price decimal.Decimal) {
+	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
+		panic("invalid token received: cannot maintain determinism")
+	}
+	if ob.journal != nil {
+		ob.journal.setReference(tok, price)
+	}
+	ob.checkBreaker(tok)
+
+	ob.collar.reference = price
+}
+
+// collarEdge returns the band edge for an order on side rounded to the tick
+// size inside the band
+func (ob *OrderBook) collarEdge(side SideType, lp decimal.Decimal) (decimal.Decimal, bandKind) {
+	edge, band := ob.collar.edge(side, lp)
+	if side == Buy {
+		return ob.inst.floor(edge), band
+	}
+	return ob.inst.ceil(edge), band
+}
+
+// breaker reports whether a circuit breaker is configured
+func (c *collar) breaker() bool {
+	return c.haltTokens != 0 || c.haltTime != 0
+}
+
+// beyond reports whether the limit price of o is outside of the band edge
+func (o *Order) beyond(edge decimal.Decimal) bool {
+	if o.Side == Buy {
+		return o.Price.GreaterThan(edge)
+	}
+	return o.Price.LessThan(edge)
+}
+
+// collared reports whether o stopped matching at the band edge, i.e. it still
+// crosses the best opposite price but that price is outside of the band
+func (ob *OrderBook) collared(o *Order, edge decimal.Decimal) bool {
+	if o.Side == Buy {
+		q := ob.asks.MinPriceQueue()
+		return q != nil && q.Price().GreaterThan(edge) && (o.Class == Market || q.Price().LessThanOrEqual(o.Price))
+	}
+
+	q := ob.bids.MaxPriceQueue()
+	return q != nil && q.Price().LessThan(edge) && (o.Class == Market || q.Price().GreaterThanOrEqual(o.Price))
+}
+
+// collarRemainder handles the remainder of an order that stopped matching at
+// the band edge or is priced beyond it. An order stopped at the dynamic band
+// trips the circuit breaker, if there is one, and rests in the volatility
+// auction that follows.
+func (ob *OrderBook) collarRemainder(o *Order, left, edge decimal.Decimal, band bandKind) {
+	if band == bandDynamic && ob.collar.breaker() && ob.state == Continuous && ob.collared(o, edge) {
+		ob.tripBreaker()
+	}
+
+	auction := ob.state.collects()
+	canRest := o.Flag&(IoC|FoK) == 0 && (!auction || o.Flag&AoN == 0)
+	switch {
+	case canRest && auction:
+		o.Qty = left
+		ob.restAuction(o)
+	case canRest && ob.collar.action == CollarRest:
+		o.Class, o.Price, o.Qty = Limit, edge, left
+		ob.rest(o)
+	default:
+		ob.putOrder(MsgCreateOrder, Canceled, o, left, decimal.Zero, ReasonCollar, nil)
+		ob.release(o)
+	}
+}
+
+// cancelOutOfBand cancels the resting orders opposite to o that are priced
+// outside of the band, e.g. after the reference price moved, and that o would
+// trade with. Makers o cannot reach are left alone.
+func (ob *OrderBook) cancelOutOfBand(o *Order, lp decimal.Decimal) {
+	contra := Buy
+	if o.Side == Buy {
+		contra = Sell
+	}
+
+	edge, band := ob.collarEdge(contra, lp)
+	if band == bandNone {
+		return
+	}
+
+	for {
+		var q *orderQueue
+		if o.Side == Buy {
+			if q = ob.asks.MinPriceQueue(); q == nil || !q.Price().LessThan(edge) {
+				return
+			}
+		} else if q = ob.bids.MaxPriceQueue(); q == nil || !q.Price().GreaterThan(edge) {
+			return
+		}
+
+		if o.Class != Market && !ob.crosses(o.Side, o.Price) {
+			return
+		}
+
+		m := q.Head()
+		ob.cancelOrder(m.ID)
+		ob.putOrder(MsgCancelOrder, Canceled, m, m.Qty, decimal.Zero, ReasonCollar, nil)
+		ob.release(m)
+	}
+}
+
+// tripBreaker moves the book into a volatility auction
+func (ob *OrderBook) tripBreaker() {
+	c := &ob.collar
+	c.tripped = true
+	c.untilToken = ob.lastToken + c.haltTokens
+	c.untilTime = ob.now + c.haltTime
+
+	ob.changeState(VolatilityAuction)
+}
+
+// checkBreaker ends a volatility auction started by the circuit breaker once
+// both its tokens and its time elapsed. The book is uncrossed and goes back to
+// continuous matching before tok is processed.
+func (ob *OrderBook) checkBreaker(tok uint64) {
+	c := &ob.collar
+	if !c.tripped || tok <= c.untilToken || ob.now < c.untilTime {
+		return
+	}
+
+	c.tripped = false
+	ob.uncross(Continuous)
+}
@@ -0,0 +1,238 @@
+package orderbook
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollar_StaticBand(t *testing.T) {
+	tok = 1
+	r := &eventRecorder{}
+	ob := NewOrderBook(nil, WithEventHandler(r), WithStaticBand(decimal.New(100, 0), Band{Offset: decimal.New(15, 0)}))
+	addDepth(ob, 0)
+	r.events = nil
+
+	processLine(ob, "11	M	B	6	0	0	N")
+	processLine(ob, "12	L	S	3	60	0	N")
+
+	assert.Equal(t, []string{
+		"CreateOrder Accepted 11 buy 0 qty=6 leaves=6 filled=0 None",
+		"T1 6 11 FilledComplete FilledPartial buy 2@100 maker=0 taker=4",
+		"T2 7 11 FilledComplete FilledPartial buy 2@110 maker=0 taker=2",
+		"CreateOrder Canceled 11 buy 0 qty=2 leaves=0 filled=4 Collar",
+		"CreateOrder Accepted 12 sell 60 qty=3 leaves=3 filled=0 None",
+		"T3 5 12 FilledComplete FilledPartial sell 2@90 maker=0 taker=1",
+		"CreateOrder Canceled 12 sell 60 qty=1 leaves=0 filled=2 Collar",
+	}, r.events)
+	assert.Equal(t, decimal.New(120, 0), ob.asks.MinPriceQueue().Price())
+	assert.Equal(t, decimal.New(80, 0), ob.bids.MaxPriceQueue().Price())
+}
+
+func TestCollar_Rest(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithStaticBand(decimal.New(100, 0), Band{Offset: decimal.New(15, 0)}), WithCollarAction(CollarRest))
+	addDepth(ob, 0)
+	n.Reset()
+
+	processLine(ob, "11	L	B	6	150	0	N")
+	processLine(ob, "12	M	S	1	0	0	N")
+	processLine(ob, "13	L	B	1	105	0	N")
+
+	// The remainder of a market order would rest under its id, so the id
+	// must not be taken
+	processLine(ob, "11	M	B	1	0	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 11 6",
+		"6 11 FilledComplete FilledPartial 2 100",
+		"7 11 FilledComplete FilledPartial 2 110",
+		"CreateOrder Accepted 12 1",
+		"11 12 FilledPartial FilledComplete 1 115",
+		"CreateOrder Accepted 13 1",
+		"CreateOrder Rejected 11 0 ErrOrderExists",
+	})
+	assert.Equal(t, Limit, ob.Order(11).Class)
+	assert.Equal(t, decimal.New(1, 0), ob.Order(11).Qty)
+	assert.Equal(t, decimal.New(115, 0), ob.Order(11).Price)
+	assert.Equal(t, decimal.New(105, 0), ob.Order(13).Price)
+}
+
+func TestCollar_EmptyContraSide(t *testing.T) {
+	tests := []struct {
+		action   CollarAction
+		expected []string
+	}{
+		{CollarCancel, []string{
+			"CreateOrder Accepted 1 2",
+			"CreateOrder Canceled 1 2",
+			"CreateOrder Accepted 2 1",
+			"CreateOrder Canceled 2 1",
+		}},
+		{CollarRest, []string{
+			"CreateOrder Accepted 1 2",
+			"CreateOrder Accepted 2 1",
+			"1 2 FilledPartial FilledComplete 1 115",
+		}},
+	}
+
+	for _, tt := range tests {
+		tok = 1
+		n := &Notification{}
+		ob := NewOrderBook(n, WithStaticBand(decimal.New(100, 0), Band{Offset: decimal.New(15, 0)}), WithCollarAction(tt.action))
+
+		// A limit order beyond the band never rests at its own price
+		processLine(ob, "1	L	B	2	150	0	N")
+		processLine(ob, "2	M	S	1	0	0	N")
+		n.Verify(t, tt.expected)
+	}
+}
+
+func TestCollar_Maker(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithStaticBand(decimal.New(100, 0), Band{Offset: decimal.New(15, 0)}))
+
+	// Orders collected before the open are not checked against the band
+	require.NoError(t, setState(ob, Closed))
+	require.NoError(t, setState(ob, PreOpen))
+	processLine(ob, "1	L	B	2	150	0	N")
+	processLine(ob, "2	L	B	2	110	0	N")
+	require.NoError(t, setState(ob, OpeningAuction))
+	require.NoError(t, setState(ob, Continuous))
+
+	// Makers outside of the band are canceled instead of trading, but only
+	// once an incoming order would trade with them
+	n.Reset()
+	processLine(ob, "3	L	S	1	160	0	N")
+	processLine(ob, "4	L	B	1	90	0	N")
+	processLine(ob, "5	M	S	1	0	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 3 1",
+		"CreateOrder Accepted 4 1",
+		"CreateOrder Accepted 5 1",
+		"CancelOrder Canceled 1 2",
+		"2 5 FilledPartial FilledComplete 1 110",
+	})
+}
+
+func TestCollar_ReferencePrice(t *testing.T) {
+	var journal, snap bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	n := &Notification{}
+	band := WithStaticBand(decimal.New(100, 0), Band{Offset: decimal.New(15, 0)})
+	ob := NewOrderBook(n, band, WithJournal(j))
+	addDepth(ob, 0)
+	ob.SetReferencePrice(tok, decimal.New(130, 0))
+	tok++
+	require.NoError(t, ob.Snapshot(&snap))
+
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(&snap, rn, band)
+	require.NoError(t, err)
+
+	// Asks below the moved band are canceled instead of trading
+	n.Reset()
+	next := tok
+	for _, b := range []*OrderBook{ob, rob} {
+		tok = next
+		processLine(b, "11	M	B	3	0	0	N")
+	}
+	n.Verify(t, []string{
+		"CreateOrder Accepted 11 3",
+		"CancelOrder Canceled 6 2",
+		"CancelOrder Canceled 7 2",
+		"8 11 FilledComplete FilledPartial 2 120",
+		"9 11 FilledPartial FilledComplete 1 130",
+	})
+	assert.Equal(t, n.Strings(), rn.Strings())
+	require.NoError(t, j.Flush())
+
+	job := NewOrderBook(&Notification{}, band)
+	require.NoError(t, Replay(&journal, job))
+	assert.Equal(t, ob.StateHash(), job.StateHash())
+	assert.Equal(t, decimal.New(130, 0), job.collar.reference)
+}
+
+func TestCollar_DynamicBand(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithDynamicBand(Band{Offset: decimal.MustParse("0.1"), Percent: true}))
+	addDepth(ob, 0)
+
+	// Without a last price there is no dynamic band
+	processLine(ob, "11	M	B	1	0	0	N")
+
+	n.Reset()
+	processLine(ob, "12	M	B	5	0	0	N")
+	processLine(ob, "13	L	S	1	90	0	I")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 12 5",
+		"6 12 FilledComplete FilledPartial 1 100",
+		"7 12 FilledComplete FilledPartial 2 110",
+		"CreateOrder Canceled 12 2",
+		"CreateOrder Accepted 13 1",
+		"CreateOrder Canceled 13 1",
+	})
+}
+
+func TestCollar_CircuitBreaker(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	sn := &stateNotification{}
+	ob := NewOrderBook(n, WithStateHandler(sn),
+		WithDynamicBand(Band{Offset: decimal.New(10, 0)}),
+		WithCircuitBreaker(3, time.Minute),
+	)
+	addDepth(ob, 0)
+	processLine(ob, "11	M	B	1	0	0	N")
+
+	n.Reset()
+	processLine(ob, "12	L	B	6	130	0	N")
+	require.Equal(t, VolatilityAuction, ob.State())
+	processLine(ob, "13	L	S	2	105	0	N")
+	processLine(ob, "14	L	S	1	100	0	I")
+
+	var snap bytes.Buffer
+	require.NoError(t, ob.Snapshot(&snap))
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(&snap, rn)
+	require.NoError(t, err)
+	assert.Equal(t, VolatilityAuction, rob.State())
+
+	// The auction lasts until three tokens were consumed and a minute passed
+	next := tok
+	for _, b := range []*OrderBook{ob, rob} {
+		tok = next
+		advanceTime(b, at(0, 1))
+		assert.Equal(t, VolatilityAuction, b.State())
+		b.CancelOrder(tok, 1)
+		tok++
+		assert.Equal(t, Continuous, b.State())
+	}
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 12 6",
+		"6 12 FilledComplete FilledPartial 1 100",
+		"7 12 FilledComplete FilledPartial 2 110",
+		"CreateOrder Accepted 13 2",
+		"CreateOrder Rejected 14 1 ErrSessionState",
+		"12 13 FilledPartial FilledComplete 2 120",
+		"12 8 FilledComplete FilledPartial 1 120",
+		"CancelOrder Canceled 1 2",
+	})
+	assert.Equal(t, n.Strings()[5:], rn.Strings())
+	assert.Equal(t, ob.StateHash(), rob.StateHash())
+	assert.Equal(t, []string{
+		"Continuous VolatilityAuction 0",
+		fmt.Sprintf("VolatilityAuction Continuous %d", at(0, 1)),
+	}, sn.changes)
+}
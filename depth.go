@@ -0,0 +1,61 @@
+package orderbook
+
+import (
+	decimal "github.com/geseq/udecimal"
+)
+
+// DepthLevel is the aggregated quantity resting at a single price
+type DepthLevel struct {
+	Price      decimal.Decimal `json:"price" `
+	Qty        decimal.Decimal `json:"qty" ` // includes the hidden reserve of iceberg orders
+	VisibleQty decimal.Decimal `json:"visibleQty" `
+	Orders     uint64          `json:"orders" `
+}
+
+// Depth returns up to levels aggregated price levels of each side of the
+// book, best price first. Market orders collected during an auction and held
+// bracket exits are not part of any level; see Orders(MarketBidBook) and
+// Orders(HeldBook).
+//
+// Depth does not consume a token and must not be called concurrently with any
+// other method of the order book.
+func (ob *OrderBook) Depth(levels int) (bids, asks []DepthLevel) {
+	bids = make([]DepthLevel, min(levels, ob.bids.Depth()))
+	asks = make([]DepthLevel, min(levels, ob.asks.Depth()))
+	nb, na := ob.DepthInto(bids, asks)
+	return bids[:nb], asks[:na]
+}
+
+// DepthInto is the allocation free variant of Depth. It fills bids and asks
+// with the best price levels of each side up to their length and returns the
+// number of levels written to each.
+func (ob *OrderBook) DepthInto(bids, asks []DepthLevel) (nb, na int) {
+	return ob.bids.depthInto(bids), ob.asks.depthInto(asks)
+}
+
+// depthInto writes the aggregated levels of the side to dst, best price first
+func (pl *priceLevel) depthInto(dst []DepthLevel) (n int) {
+	if len(dst) == 0 {
+		return 0
+	}
+
+	it := pl.priceTree.Iterator()
+	step := it.Next
+	if pl.priceType == BidPrice {
+		it.End()
+		step = it.Prev
+	}
+
+	for n < len(dst) && step() {
+		q := it.Value()
+		dst[n] = DepthLevel{
+			Price:      q.Price(),
+			Qty:        q.TotalQty(),
+			VisibleQty: q.VisibleQty(),
+			Orders:     q.Len(),
+		}
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,55 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDepth(t *testing.T) {
+	_, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	2	90	0	N")
+	processLine(ob, "2	L	B	3	90	0	N")
+	processLine(ob, "3	L	B	1	80	0	N")
+	processLine(ob, "4	L	B	1	70	0	N")
+	processLine(ob, "5	L	S	4	100	0	N")
+	addIceberg(ob, 6, Sell, 10, 2, 110)
+
+	bids, asks := ob.Depth(2)
+	assert.Equal(t, []DepthLevel{
+		{Price: decimal.New(90, 0), Qty: decimal.New(5, 0), VisibleQty: decimal.New(5, 0), Orders: 2},
+		{Price: decimal.New(80, 0), Qty: decimal.New(1, 0), VisibleQty: decimal.New(1, 0), Orders: 1},
+	}, bids)
+	assert.Equal(t, []DepthLevel{
+		{Price: decimal.New(100, 0), Qty: decimal.New(4, 0), VisibleQty: decimal.New(4, 0), Orders: 1},
+		{Price: decimal.New(110, 0), Qty: decimal.New(10, 0), VisibleQty: decimal.New(2, 0), Orders: 1},
+	}, asks)
+
+	bids, asks = ob.Depth(10)
+	assert.Len(t, bids, 3)
+	assert.Len(t, asks, 2)
+	assert.Equal(t, decimal.New(70, 0), bids[2].Price)
+
+	bids, asks = ob.Depth(0)
+	assert.Empty(t, bids)
+	assert.Empty(t, asks)
+}
+
+func TestDepthInto(t *testing.T) {
+	_, ob := getTestOrderBook()
+	addDepth(ob, 0)
+
+	bids := make([]DepthLevel, 3)
+	asks := make([]DepthLevel, 1)
+	nb, na := ob.DepthInto(bids, asks)
+	assert.Equal(t, 3, nb)
+	assert.Equal(t, 1, na)
+	assert.True(t, bids[0].Price.GreaterThan(bids[1].Price))
+	assert.True(t, asks[0].Price.GreaterThan(bids[0].Price))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ob.DepthInto(bids, asks)
+	})
+	assert.Zero(t, allocs)
+}
@@ -12,4 +12,21 @@ var (
 	ErrOrderNotExists       = errors.New("orderbook: order does not exist")
 	ErrInsufficientQuantity = errors.New("orderbook: insufficient quantity to calculate price")
 	ErrNoMatching           = errors.New("orderbook: matching disabled")
+	ErrInvalidSnapshot      = errors.New("orderbook: invalid snapshot")
+	ErrInvalidDisplayQty    = errors.New("orderbook: display quantity exceeds order quantity")
+	ErrPostOnly             = errors.New("orderbook: post-only order would take liquidity")
+	ErrSelfTrade            = errors.New("orderbook: self-trade prevented")
+	ErrNotFillable          = errors.New("orderbook: order cannot be filled entirely")
+	ErrOrderExpired         = errors.New("orderbook: order expired")
+	ErrInvalidTrail         = errors.New("orderbook: invalid trailing stop")
+	ErrLinkedOrder          = errors.New("orderbook: canceled by linked order")
+	ErrInvalidJournal       = errors.New("orderbook: invalid journal")
+	ErrInstrumentExists     = errors.New("orderbook: instrument already exists")
+	ErrInstrumentNotExists  = errors.New("orderbook: instrument does not exist")
+	ErrSessionState         = errors.New("orderbook: order not accepted in current session state")
+	ErrStateTransition      = errors.New("orderbook: invalid session state transition")
+	ErrTickSize             = errors.New("orderbook: price is not a multiple of the tick size")
+	ErrLotSize              = errors.New("orderbook: quantity is not a multiple of the lot size")
+	ErrQtyOutOfRange        = errors.New("orderbook: order quantity out of range")
+	ErrMaxNotional          = errors.New("orderbook: order notional exceeds maximum")
 )
@@ -0,0 +1,190 @@
+package orderbook
+
+import (
+	decimal "github.com/geseq/udecimal"
+)
+
+// EventVersion is the version of the events passed to an EventHandler. It is
+// incremented whenever fields are added to the events or their meaning
+// changes.
+const EventVersion uint8 = 1
+
+// EventHandler receives order and trade events. It reports everything a
+// NotificationHandler does and more, see NewNotificationAdapter.
+//
+// The events are owned by the order book and are only valid for the duration
+// of the call.
+type EventHandler interface {
+	OnOrderEvent(e *OrderEvent)
+	OnTradeEvent(e *TradeEvent)
+}
+
+// CancelReason tells why an order left the book without being filled
+type CancelReason byte
+
+const (
+	// ReasonNone is used for events that do not remove an order
+	ReasonNone CancelReason = iota
+	// ReasonUser is a cancellation requested with CancelOrder
+	ReasonUser
+	// ReasonIoC is the unfilled remainder of an IoC or market order
+	ReasonIoC
+	// ReasonFoK is a FoK or AoN order that could not be filled entirely
+	ReasonFoK
+	// ReasonExpired is a GTD or DAY order that expired
+	ReasonExpired
+	// ReasonSelfTrade is a cancellation by self-trade prevention
+	ReasonSelfTrade
+	// ReasonPostOnly is a post-only order that would have taken liquidity
+	ReasonPostOnly
+	// ReasonLinked is an OCO leg or bracket exit canceled by a linked order
+	ReasonLinked
+	// ReasonCollar is the remainder of an order that reached a price band
+	ReasonCollar
+)
+
+// String implements fmt.Stringer interface
+func (r CancelReason) String() string {
+	switch r {
+	case ReasonUser:
+		return "User"
+	case ReasonIoC:
+		return "IoC"
+	case ReasonFoK:
+		return "FoK"
+	case ReasonExpired:
+		return "Expired"
+	case ReasonSelfTrade:
+		return "SelfTrade"
+	case ReasonPostOnly:
+		return "PostOnly"
+	case ReasonLinked:
+		return "Linked"
+	case ReasonCollar:
+		return "Collar"
+	default:
+		return "None"
+	}
+}
+
+// OrderEvent reports a change of the state of an order
+type OrderEvent struct {
+	Version uint8           `json:"version" `
+	MsgType MsgType         `json:"msgType" `
+	Status  OrderStatus     `json:"status" `
+	OrderID uint64          `json:"orderId" `
+	Side    SideType        `json:"side" `
+	Price   decimal.Decimal `json:"price" `
+
+	// Qty is the quantity the event refers to, e.g. the quantity canceled
+	Qty decimal.Decimal `json:"qty" `
+	// LeavesQty is the quantity of the order still open after the event
+	LeavesQty decimal.Decimal `json:"leavesQty" `
+	// FilledQty is the cumulative quantity filled so far
+	FilledQty decimal.Decimal `json:"filledQty" `
+
+	Reason CancelReason `json:"reason" `
+	Err    error        `json:"-" `
+}
+
+// TradeEvent reports a match between a resting maker and an incoming taker
+type TradeEvent struct {
+	Version       uint8       `json:"version" `
+	TradeID       uint64      `json:"tradeId" `
+	MakerOrderID  uint64      `json:"makerOrderId" `
+	TakerOrderID  uint64      `json:"takerOrderId" `
+	MakerStatus   OrderStatus `json:"makerStatus" `
+	TakerStatus   OrderStatus `json:"takerStatus" `
+	AggressorSide SideType    `json:"aggressorSide" `
+
+	Qty            decimal.Decimal `json:"qty" `
+	Price          decimal.Decimal `json:"price" `
+	MakerLeavesQty decimal.Decimal `json:"makerLeavesQty" `
+	TakerLeavesQty decimal.Decimal `json:"takerLeavesQty" `
+}
+
+// NewNotificationAdapter returns an EventHandler that passes events on to the
+// two methods of n. The fields that PutOrder and PutTrade have no parameter
+// for are dropped.
+func NewNotificationAdapter(n NotificationHandler) EventHandler {
+	return notificationAdapter{n: n}
+}
+
+type notificationAdapter struct {
+	n NotificationHandler
+}
+
+func (a notificationAdapter) OnOrderEvent(e *OrderEvent) {
+	a.n.PutOrder(e.MsgType, e.Status, e.OrderID, e.Qty, e.Err)
+}
+
+func (a notificationAdapter) OnTradeEvent(e *TradeEvent) {
+	a.n.PutTrade(e.MakerOrderID, e.TakerOrderID, e.MakerStatus, e.TakerStatus, e.Qty, e.Price)
+}
+
+// putOrder reports an event of order o. qty is the quantity the event refers
+// to and leaves the quantity of o still open afterwards.
+func (ob *OrderBook) putOrder(m MsgType, s OrderStatus, o *Order, qty, leaves decimal.Decimal, reason CancelReason, err error) {
+	e := &ob.orderEvent
+	*e = OrderEvent{
+		Version:   EventVersion,
+		MsgType:   m,
+		Status:    s,
+		OrderID:   o.ID,
+		Side:      o.Side,
+		Price:     o.Price,
+		Qty:       qty,
+		LeavesQty: leaves,
+		FilledQty: o.filledQty,
+		Reason:    reason,
+		Err:       err,
+	}
+	ob.events.OnOrderEvent(e)
+}
+
+// putReject reports a rejected request
+func (ob *OrderBook) putReject(m MsgType, id uint64, side SideType, price, qty decimal.Decimal, reason CancelReason, err error) {
+	e := &ob.orderEvent
+	*e = OrderEvent{
+		Version: EventVersion,
+		MsgType: m,
+		Status:  Rejected,
+		OrderID: id,
+		Side:    side,
+		Price:   price,
+		Qty:     qty,
+		Reason:  reason,
+		Err:     err,
+	}
+	ob.events.OnOrderEvent(e)
+}
+
+// putTrade reports a trade between maker and taker at the maker's price and
+// updates their filled quantities
+func (ob *OrderBook) putTrade(maker, taker *Order, makerStatus, takerStatus OrderStatus, qty, makerLeaves, takerLeaves decimal.Decimal) {
+	ob.putTradeAt(maker, taker, makerStatus, takerStatus, qty, makerLeaves, takerLeaves, maker.Price)
+}
+
+// putTradeAt reports a trade between maker and taker at price
+func (ob *OrderBook) putTradeAt(maker, taker *Order, makerStatus, takerStatus OrderStatus, qty, makerLeaves, takerLeaves, price decimal.Decimal) {
+	maker.filledQty = maker.filledQty.Add(qty)
+	taker.filledQty = taker.filledQty.Add(qty)
+	ob.lastPrice = price
+	ob.tradeID++
+
+	e := &ob.tradeEvent
+	*e = TradeEvent{
+		Version:        EventVersion,
+		TradeID:        ob.tradeID,
+		MakerOrderID:   maker.ID,
+		TakerOrderID:   taker.ID,
+		MakerStatus:    makerStatus,
+		TakerStatus:    takerStatus,
+		AggressorSide:  taker.Side,
+		Qty:            qty,
+		Price:          price,
+		MakerLeavesQty: makerLeaves,
+		TakerLeavesQty: takerLeaves,
+	}
+	ob.events.OnTradeEvent(e)
+}
@@ -0,0 +1,107 @@
+package orderbook
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) OnOrderEvent(e *OrderEvent) {
+	r.events = append(r.events, fmt.Sprintf("%s %s %d %s %s qty=%s leaves=%s filled=%s %s",
+		e.MsgType, e.Status, e.OrderID, e.Side, e.Price, e.Qty, e.LeavesQty, e.FilledQty, e.Reason))
+}
+
+func (r *eventRecorder) OnTradeEvent(e *TradeEvent) {
+	r.events = append(r.events, fmt.Sprintf("T%d %d %d %s %s %s %s@%s maker=%s taker=%s",
+		e.TradeID, e.MakerOrderID, e.TakerOrderID, e.MakerStatus, e.TakerStatus, e.AggressorSide, e.Qty, e.Price, e.MakerLeavesQty, e.TakerLeavesQty))
+}
+
+func TestEvents(t *testing.T) {
+	r := &eventRecorder{}
+	ob := NewOrderBook(nil, WithEventHandler(r))
+	tok = 1
+
+	processLine(ob, "1	L	S	5	100	0	N")
+	processLine(ob, "2	L	S	5	110	0	N")
+	processLine(ob, "3	L	B	7	105	0	I")
+	processLine(ob, "4	M	S	1	0	95	SL")
+	processLine(ob, "5	L	B	1	90	0	N")
+	processLine(ob, "6	M	B	3	0	0	N")
+	ob.CancelOrder(tok, 2)
+	tok++
+	processLine(ob, "7	L	B	1	50	0	F")
+
+	assert.Equal(t, []string{
+		"CreateOrder Accepted 1 sell 100 qty=5 leaves=5 filled=0 None",
+		"CreateOrder Accepted 2 sell 110 qty=5 leaves=5 filled=0 None",
+		"CreateOrder Accepted 3 buy 105 qty=7 leaves=7 filled=0 None",
+		"T1 1 3 FilledComplete FilledPartial buy 5@100 maker=0 taker=2",
+		"CreateOrder Canceled 3 buy 105 qty=2 leaves=0 filled=5 IoC",
+		"CreateOrder Accepted 4 sell 0 qty=1 leaves=1 filled=0 None",
+		"CreateOrder Accepted 5 buy 90 qty=1 leaves=1 filled=0 None",
+		"CreateOrder Accepted 6 buy 0 qty=3 leaves=3 filled=0 None",
+		"T2 2 6 FilledPartial FilledComplete buy 3@110 maker=2 taker=0",
+		"CancelOrder Canceled 2 sell 110 qty=2 leaves=0 filled=3 User",
+		"CreateOrder Rejected 7 buy 50 qty=1 leaves=0 filled=0 FoK",
+	}, r.events)
+
+	r.events = nil
+	processLine(ob, "8	L	S	1	90	0	N") // @ LP 90
+	assert.Equal(t, []string{
+		"CreateOrder Accepted 8 sell 90 qty=1 leaves=1 filled=0 None",
+		"T3 5 8 FilledComplete FilledComplete sell 1@90 maker=0 taker=0",
+		"CreateOrder Triggered 4 sell 0 qty=1 leaves=1 filled=0 None",
+		"CreateOrder Canceled 4 sell 0 qty=1 leaves=0 filled=0 IoC",
+	}, r.events)
+}
+
+func TestEvents_Adapter(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	processLine(ob, "1	L	S	5	100	0	N")
+	processLine(ob, "2	L	B	7	105	0	I")
+	processLine(ob, "3	M	S	1	0	100	SL")
+	processLine(ob, "4	L	B	1	100	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 5",
+		"CreateOrder Accepted 2 7",
+		"1 2 FilledComplete FilledPartial 5 100",
+		"CreateOrder Canceled 2 2",
+		"CreateOrder Accepted 3 1",
+		"CreateOrder Triggered 3 1",
+		"CreateOrder Canceled 3 1",
+		"CreateOrder Accepted 4 1",
+	})
+}
+
+func TestEvents_Snapshot(t *testing.T) {
+	r := &eventRecorder{}
+	ob := NewOrderBook(nil, WithEventHandler(r))
+	tok = 1
+
+	processLine(ob, "1	L	S	5	100	0	N")
+	processLine(ob, "2	M	B	2	0	0	N")
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	rr := &eventRecorder{}
+	rob, err := RestoreOrderBook(&buf, nil, WithEventHandler(rr))
+	require.NoError(t, err)
+	assert.Equal(t, decimal.New(2, 0), rob.Order(1).FilledQty())
+
+	processLine(rob, "3	M	B	1	0	0	N")
+	assert.Equal(t, []string{
+		"CreateOrder Accepted 3 buy 0 qty=1 leaves=1 filled=0 None",
+		"T2 1 3 FilledPartial FilledComplete buy 1@100 maker=2 taker=0",
+	}, rr.events)
+}
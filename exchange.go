@@ -0,0 +1,188 @@
+package orderbook
+
+import (
+	"slices"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// Exchange owns the order books of many instruments and routes commands to
+// them by instrument ID.
+//
+// Every book keeps its own token sequence, so the token passed with a command
+// is the next token of the book it is routed to. The books of an exchange
+// either share one Pools, in which case they must all be driven from one
+// goroutine, or each allocate from pools of their own that are filled on
+// demand.
+//
+// An Exchange is not safe for concurrent use. Adding and removing books
+// changes the map that every command is routed through, so all methods,
+// including the read-only ones, must be called from one goroutine or be
+// synchronized by the caller.
+type Exchange struct {
+	books       map[uint64]*OrderBook
+	instruments []uint64 // sorted instrument IDs
+	pools       *Pools
+}
+
+// ExchangeStats aggregates the state of every book of an exchange
+type ExchangeStats struct {
+	Books         int
+	Orders        uint64 // resting orders in bids and asks, and collected market orders
+	TriggerOrders uint64 // stop and take profit orders waiting to trigger
+	HeldOrders    uint64 // bracket exits waiting for their entry to fill
+	Tokens        uint64 // tokens consumed
+	Trades        uint64 // trades executed
+}
+
+// NewExchange creates an exchange whose books allocate from pools. If pools is
+// nil every book creates its own pools from its pool size options.
+func NewExchange(pools *Pools) *Exchange {
+	return &Exchange{
+		books: make(map[uint64]*OrderBook),
+		pools: pools,
+	}
+}
+
+// AddBook creates the order book of an instrument. The options are applied as
+// they would be by NewOrderBook, except that the book uses the pools of the
+// exchange if it has any.
+func (e *Exchange) AddBook(instrument uint64, n NotificationHandler, opts ...Option) (*OrderBook, error) {
+	if _, ok := e.books[instrument]; ok {
+		return nil, ErrInstrumentExists
+	}
+
+	if e.pools != nil {
+		opts = append(opts[:len(opts):len(opts)], WithPools(e.pools))
+	}
+
+	ob := NewOrderBook(n, opts...)
+	e.books[instrument] = ob
+
+	i, _ := slices.BinarySearch(e.instruments, instrument)
+	e.instruments = slices.Insert(e.instruments, i, instrument)
+	return ob, nil
+}
+
+// RemoveBook removes the order book of an instrument from the exchange
+func (e *Exchange) RemoveBook(instrument uint64) error {
+	if _, ok := e.books[instrument]; !ok {
+		return ErrInstrumentNotExists
+	}
+
+	delete(e.books, instrument)
+	i, _ := slices.BinarySearch(e.instruments, instrument)
+	e.instruments = slices.Delete(e.instruments, i, i+1)
+	return nil
+}
+
+// Book returns the order book of an instrument, or nil if there is none
+func (e *Exchange) Book(instrument uint64) *OrderBook {
+	return e.books[instrument]
+}
+
+// Instruments returns the IDs of all instruments in ascending order
+func (e *Exchange) Instruments() []uint64 {
+	return slices.Clone(e.instruments)
+}
+
+// AddOrder places a new order in the book of an instrument. See
+// OrderBook.AddOrder.
+func (e *Exchange) AddOrder(instrument, tok, id uint64, class ClassType, side SideType, quantity, price, trigPrice decimal.Decimal, flag FlagType) error {
+	return e.AddOrderWithAttrs(instrument, tok, id, class, side, quantity, price, trigPrice, flag, OrderAttrs{})
+}
+
+// AddOrderWithAttrs places a new order with optional attributes in the book of
+// an instrument. See OrderBook.AddOrderWithAttrs.
+func (e *Exchange) AddOrderWithAttrs(instrument, tok, id uint64, class ClassType, side SideType, quantity, price, trigPrice decimal.Decimal, flag FlagType, attrs OrderAttrs) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	ob.AddOrderWithAttrs(tok, id, class, side, quantity, price, trigPrice, flag, attrs)
+	return nil
+}
+
+// CancelOrder cancels an order in the book of an instrument. See
+// OrderBook.CancelOrder.
+func (e *Exchange) CancelOrder(instrument, tok, orderID uint64) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	ob.CancelOrder(tok, orderID)
+	return nil
+}
+
+// ModifyOrder amends an order in the book of an instrument. See
+// OrderBook.ModifyOrder.
+func (e *Exchange) ModifyOrder(instrument, tok, id uint64, newQty, newPrice decimal.Decimal) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	ob.ModifyOrder(tok, id, newQty, newPrice)
+	return nil
+}
+
+// AdvanceTime moves the clock of the book of an instrument. See
+// OrderBook.AdvanceTime.
+func (e *Exchange) AdvanceTime(instrument, tok uint64, now int64) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	ob.AdvanceTime(tok, now)
+	return nil
+}
+
+// Uncross ends the call auction of the book of an instrument. See
+// OrderBook.Uncross.
+func (e *Exchange) Uncross(instrument, tok uint64) (Equilibrium, error) {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return Equilibrium{}, ErrInstrumentNotExists
+	}
+
+	return ob.Uncross(tok), nil
+}
+
+// SetState moves the book of an instrument to another session state. See
+// OrderBook.SetState.
+func (e *Exchange) SetState(instrument, tok uint64, state SessionState) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	return ob.SetState(tok, state)
+}
+
+// SetReferencePrice moves the reference price of the static band of the book
+// of an instrument. See OrderBook.SetReferencePrice.
+func (e *Exchange) SetReferencePrice(instrument, tok uint64, price decimal.Decimal) error {
+	ob, ok := e.books[instrument]
+	if !ok {
+		return ErrInstrumentNotExists
+	}
+
+	ob.SetReferencePrice(tok, price)
+	return nil
+}
+
+// Stats returns statistics aggregated across all books
+func (e *Exchange) Stats() ExchangeStats {
+	s := ExchangeStats{Books: len(e.books)}
+	for _, ob := range e.books {
+		s.Orders += ob.bids.Len() + ob.asks.Len() + ob.marketBids.Len() + ob.marketAsks.Len()
+		s.TriggerOrders += ob.triggerOver.Len() + ob.triggerUnder.Len()
+		s.HeldOrders += uint64(ob.heldOrders.count)
+		s.Tokens += ob.lastToken
+		s.Trades += ob.tradeID
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchange_Routing(t *testing.T) {
+	e := NewExchange(NewPools(1024, 128))
+
+	n1, n2 := &Notification{}, &Notification{}
+	ob1, err := e.AddBook(20, n1)
+	require.NoError(t, err)
+	_, err = e.AddBook(10, n2, WithMatching(true))
+	require.NoError(t, err)
+
+	_, err = e.AddBook(20, n1)
+	assert.Equal(t, ErrInstrumentExists, err)
+	assert.Equal(t, []uint64{10, 20}, e.Instruments())
+	assert.Equal(t, ob1, e.Book(20))
+
+	// Each book has its own token sequence
+	require.NoError(t, e.AddOrder(20, 1, 1, Limit, Sell, decimal.New(2, 0), decimal.New(100, 0), decimal.Zero, None))
+	require.NoError(t, e.AddOrder(10, 1, 1, Limit, Buy, decimal.New(5, 0), decimal.New(50, 0), decimal.Zero, None))
+	require.NoError(t, e.AddOrder(20, 2, 2, Market, Buy, decimal.New(1, 0), decimal.Zero, decimal.Zero, None))
+	require.NoError(t, e.ModifyOrder(10, 2, 1, decimal.New(3, 0), decimal.New(50, 0)))
+	require.NoError(t, e.AddOrderWithAttrs(10, 3, 2, Limit, Sell, decimal.New(1, 0), decimal.New(60, 0), decimal.Zero, None, OrderAttrs{
+		TIF:      GTD,
+		ExpireAt: 100,
+	}))
+	require.NoError(t, e.AdvanceTime(10, 4, 100))
+	require.NoError(t, e.CancelOrder(20, 3, 1))
+
+	n1.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"CreateOrder Accepted 2 1",
+		"1 2 FilledPartial FilledComplete 1 100",
+		"CancelOrder Canceled 1 1",
+	})
+	n2.Verify(t, []string{
+		"CreateOrder Accepted 1 5",
+		"ModifyOrder Accepted 1 3",
+		"CreateOrder Accepted 2 1",
+		"CancelOrder Canceled 2 1 ErrOrderExpired",
+	})
+
+	assert.Equal(t, ExchangeStats{
+		Books:  2,
+		Orders: 1,
+		Tokens: 7,
+		Trades: 1,
+	}, e.Stats())
+
+	assert.Equal(t, ErrInstrumentNotExists, e.AddOrder(30, 1, 1, Limit, Buy, decimal.New(1, 0), decimal.New(1, 0), decimal.Zero, None))
+	assert.Equal(t, ErrInstrumentNotExists, e.CancelOrder(30, 1, 1))
+	assert.Equal(t, ErrInstrumentNotExists, e.ModifyOrder(30, 1, 1, decimal.New(1, 0), decimal.New(1, 0)))
+	assert.Equal(t, ErrInstrumentNotExists, e.AdvanceTime(30, 1, 0))
+
+	require.NoError(t, e.RemoveBook(20))
+	assert.Equal(t, ErrInstrumentNotExists, e.RemoveBook(20))
+	assert.Nil(t, e.Book(20))
+	assert.Equal(t, []uint64{10}, e.Instruments())
+	assert.Equal(t, 1, e.Stats().Books)
+
+	// Held bracket exits are counted apart from resting orders
+	require.NoError(t, e.AddOrderWithAttrs(10, 5, 4, Limit, Sell, decimal.New(3, 0), decimal.New(70, 0), decimal.Zero, None, OrderAttrs{
+		Parent: 1,
+	}))
+	assert.Equal(t, ExchangeStats{
+		Books:      1,
+		Orders:     1,
+		HeldOrders: 1,
+		Tokens:     5,
+	}, e.Stats())
+}
@@ -0,0 +1,112 @@
+package orderbook
+
+import (
+	"sync/atomic"
+	"time"
+
+	local_tree "github.com/geseq/orderbook/pkg/tree"
+	decimal "github.com/geseq/udecimal"
+)
+
+// TimeInForce of the order
+type TimeInForce byte
+
+const (
+	// GTC orders rest until they are filled or canceled
+	GTC TimeInForce = iota
+	// GTD orders rest until OrderAttrs.ExpireAt
+	GTD
+	// DAY orders rest until the next session close
+	DAY
+)
+
+// String implements fmt.Stringer interface
+func (t TimeInForce) String() string {
+	switch t {
+	case GTD:
+		return "GTD"
+	case DAY:
+		return "DAY"
+	default:
+		return "GTC"
+	}
+}
+
+// sessionLength is the interval between two session closes
+const sessionLength = int64(24 * time.Hour)
+
+// Int64Cmp compares two int64.
+func Int64Cmp(a, b int64) int {
+	if a == b {
+		return 0
+	}
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// newExpiryTree creates the tree that maps an expiry time to the IDs of the
+// orders expiring at that time
+func newExpiryTree(poolSize uint64) *local_tree.Tree[int64, []uint64] {
+	return local_tree.NewWithPool(Int64Cmp, local_tree.NewNodePool[int64, []uint64](poolSize))
+}
+
+// nextSessionClose returns the first session close strictly after the book's
+// current time
+func (ob *OrderBook) nextSessionClose() int64 {
+	since := (ob.now - ob.sessionClose) % sessionLength
+	if since < 0 {
+		since += sessionLength
+	}
+
+	return ob.now - since + sessionLength
+}
+
+// trackExpiry schedules a resting GTD or DAY order for expiry
+func (ob *OrderBook) trackExpiry(o *Order) {
+	if o.TIF == GTC {
+		return
+	}
+
+	ids, _ := ob.expiries.Get(o.ExpireAt)
+	ob.expiries.Put(o.ExpireAt, append(ids, o.ID))
+}
+
+// AdvanceTime moves the book's clock forward to now and expires every resting
+// GTD and DAY order whose expiry time is at or before now. Each expired order is
+// reported as canceled with ErrOrderExpired.
+//
+// The clock is driven by the sequencer rather than the wall clock so that the
+// book stays deterministic. now is expressed in nanoseconds since the Unix
+// epoch; a time earlier than the current clock leaves the clock unchanged.
+func (ob *OrderBook) AdvanceTime(tok uint64, now int64) {
+	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
+		panic("invalid token received: cannot maintain determinism")
+	}
+	if ob.journal != nil {
+		ob.journal.advanceTime(tok, now)
+	}
+
+	if now > ob.now {
+		ob.now = now
+	}
+	ob.checkBreaker(tok)
+
+	for node, ok := ob.expiries.GetMin(); ok && node.Key <= ob.now; node, ok = ob.expiries.GetMin() {
+		expireAt, ids := node.Key, node.Value
+		ob.expiries.Remove(expireAt)
+
+		for _, id := range ids {
+			// Orders that were filled or canceled since are skipped lazily
+			o := ob.Order(id)
+			if o == nil || o.TIF == GTC || o.ExpireAt != expireAt {
+				continue
+			}
+
+			ob.cancelOrder(id)
+			ob.putOrder(MsgCancelOrder, Canceled, o, o.Qty, decimal.Zero, ReasonExpired, ErrOrderExpired)
+			ob.release(o)
+		}
+	}
+}
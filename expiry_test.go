@@ -0,0 +1,126 @@
+package orderbook
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var day0 = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+func at(hours, minutes int) int64 {
+	return day0.Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute).UnixNano()
+}
+
+func addTIFOrder(ob *OrderBook, id uint64, side SideType, qty, price uint64, tif TimeInForce, expireAt int64) {
+	ob.AddOrderWithAttrs(tok, id, Limit, side, decimal.New(qty, 0), decimal.New(price, 0), decimal.Zero, None, OrderAttrs{
+		TIF:      tif,
+		ExpireAt: expireAt,
+	})
+	tok++
+}
+
+func advanceTime(ob *OrderBook, now int64) {
+	ob.AdvanceTime(tok, now)
+	tok++
+}
+
+func TestExpiry_GTD(t *testing.T) {
+	n, ob := getTestOrderBook()
+	advanceTime(ob, at(9, 0))
+
+	addTIFOrder(ob, 1, Buy, 2, 90, GTD, at(10, 0))
+	addTIFOrder(ob, 2, Buy, 2, 90, GTD, at(11, 0))
+	addTIFOrder(ob, 3, Sell, 2, 100, GTD, at(10, 0))
+	addTIFOrder(ob, 4, Sell, 2, 100, GTD, at(8, 0))
+	ob.CancelOrder(tok, 3)
+	tok++
+
+	advanceTime(ob, at(9, 59))
+	advanceTime(ob, at(10, 30))
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"CreateOrder Accepted 2 2",
+		"CreateOrder Accepted 3 2",
+		"CreateOrder Rejected 4 2 ErrOrderExpired",
+		"CancelOrder Canceled 3 2",
+		"CancelOrder Canceled 1 2 ErrOrderExpired",
+	})
+
+	assert.Nil(t, ob.Order(1))
+	assert.NotNil(t, ob.Order(2))
+
+	n.Reset()
+	processLine(ob, "5	M	S	1	0	0	N")
+	advanceTime(ob, at(11, 0))
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 5 1",
+		"2 5 FilledPartial FilledComplete 1 90",
+		"CancelOrder Canceled 2 1 ErrOrderExpired",
+	})
+	assert.Equal(t, uint64(0), ob.bids.Len())
+}
+
+func TestExpiry_Day(t *testing.T) {
+	n := &Notification{}
+	ob := NewOrderBook(n, WithSessionClose(16*time.Hour))
+	tok = 1
+
+	advanceTime(ob, at(10, 0))
+	addTIFOrder(ob, 1, Buy, 2, 90, DAY, 0)
+	assert.Equal(t, at(16, 0), ob.Order(1).ExpireAt)
+
+	advanceTime(ob, at(16, 0))
+	addTIFOrder(ob, 2, Buy, 2, 90, DAY, 0)
+	assert.Equal(t, at(40, 0), ob.Order(2).ExpireAt)
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"CancelOrder Canceled 1 2 ErrOrderExpired",
+		"CreateOrder Accepted 2 2",
+	})
+}
+
+func TestExpiry_TriggerOrder(t *testing.T) {
+	n, ob := getTestOrderBook()
+	advanceTime(ob, at(9, 0))
+
+	ob.AddOrderWithAttrs(tok, 1, Market, Buy, decimal.New(1, 0), decimal.Zero, decimal.New(120, 0), StopLoss, OrderAttrs{
+		TIF:      GTD,
+		ExpireAt: at(10, 0),
+	})
+	tok++
+
+	advanceTime(ob, at(10, 0))
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 1",
+		"CancelOrder Canceled 1 1 ErrOrderExpired",
+	})
+	assert.Equal(t, uint64(0), ob.triggerOver.Len())
+}
+
+func TestExpiry_Snapshot(t *testing.T) {
+	_, ob := getTestOrderBook()
+	advanceTime(ob, at(9, 0))
+	addTIFOrder(ob, 1, Buy, 2, 90, GTD, at(10, 0))
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(&buf, rn)
+	require.NoError(t, err)
+	assert.Equal(t, ob.now, rob.now)
+
+	rob.AdvanceTime(tok, at(10, 0))
+	rn.Verify(t, []string{
+		"CancelOrder Canceled 1 2 ErrOrderExpired",
+	})
+}
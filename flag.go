@@ -9,6 +9,7 @@ const (
 	StopLoss            = 8
 	TakeProfit          = 16
 	Snapshot            = 32
+	PostOnly            = 64
 )
 
 // String implements fmt.Stringer interface
@@ -26,6 +27,8 @@ func (f FlagType) String() string {
 		return "TakeProfit"
 	case Snapshot:
 		return "snapshot"
+	case PostOnly:
+		return "PostOnly"
 	case None:
 		return "none"
 	default:
@@ -0,0 +1,116 @@
+package orderbook
+
+import (
+	"math/bits"
+	"slices"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// TickBand sets the tick size of the prices from From up to the From of the
+// next band of a tick table
+type TickBand struct {
+	From decimal.Decimal
+	Tick decimal.Decimal
+}
+
+// instrument holds the trading parameters that orders are validated against.
+// Zero values disable the corresponding check.
+type instrument struct {
+	ticks       []TickBand // ascending From
+	lot         decimal.Decimal
+	minQty      decimal.Decimal
+	maxQty      decimal.Decimal
+	maxNotional decimal.Decimal
+	bits        decimalBits
+}
+
+// setTicks sets the tick table, sorting a copy of bands by price
+func (in *instrument) setTicks(bands []TickBand) {
+	in.ticks = slices.Clone(bands)
+	slices.SortStableFunc(in.ticks, func(a, b TickBand) int {
+		return a.From.Cmp(b.From)
+	})
+}
+
+// tick returns the tick size at price. The first band also covers the prices
+// below it.
+func (in *instrument) tick(price decimal.Decimal) decimal.Decimal {
+	if len(in.ticks) == 0 {
+		return decimal.Zero
+	}
+
+	i := len(in.ticks) - 1
+	for i > 0 && in.ticks[i].From.GreaterThan(price) {
+		i--
+	}
+	return in.ticks[i].Tick
+}
+
+// floor rounds price down to a multiple of the tick size at price
+func (in *instrument) floor(price decimal.Decimal) decimal.Decimal {
+	t := in.bits.of(in.tick(price))
+	if t == 0 {
+		return price
+	}
+	return price.Sub(decimal.NewI(in.bits.of(price)%t, 8))
+}
+
+// ceil rounds price up to a multiple of the tick size at price
+func (in *instrument) ceil(price decimal.Decimal) decimal.Decimal {
+	t := in.bits.of(in.tick(price))
+	if t == 0 {
+		return price
+	}
+	if r := in.bits.of(price) % t; r != 0 {
+		return price.Add(decimal.NewI(t-r, 8))
+	}
+	return price
+}
+
+// multipleOf reports whether x is a multiple of step. Every value is a
+// multiple of a zero step.
+func (in *instrument) multipleOf(x, step decimal.Decimal) bool {
+	s := in.bits.of(step)
+	return s == 0 || in.bits.of(x)%s == 0
+}
+
+// validate checks the quantity and prices of an order against the parameters
+// of the instrument. The notional of a market order is checked at its trigger
+// price if it has one and not at all otherwise.
+func (in *instrument) validate(class ClassType, qty, price, trigPrice decimal.Decimal) error {
+	if !in.multipleOf(qty, in.lot) {
+		return ErrLotSize
+	}
+
+	if qty.LessThan(in.minQty) || (!in.maxQty.IsZero() && qty.GreaterThan(in.maxQty)) {
+		return ErrQtyOutOfRange
+	}
+
+	if class != Market && !in.multipleOf(price, in.tick(price)) {
+		return ErrTickSize
+	}
+
+	if !trigPrice.IsZero() && !in.multipleOf(trigPrice, in.tick(trigPrice)) {
+		return ErrTickSize
+	}
+
+	if in.maxNotional.IsZero() {
+		return nil
+	}
+
+	p := price
+	if class == Market {
+		p = trigPrice
+	}
+
+	// qty*p and maxNotional*1e8 are compared in 128 bits so that large
+	// orders cannot overflow
+	hi, lo := bits.Mul64(in.bits.of(qty), in.bits.of(p))
+	maxHi, maxLo := bits.Mul64(in.bits.of(in.maxNotional), in.bits.of(decimal.New(1, 0)))
+	if hi > maxHi || (hi == maxHi && lo > maxLo) {
+		return ErrMaxNotional
+	}
+
+	return nil
+}
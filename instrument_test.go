@@ -0,0 +1,108 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument_Validation(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n,
+		WithTickTable(
+			TickBand{From: decimal.New(100, 0), Tick: decimal.New(5, 0)},
+			TickBand{From: decimal.Zero, Tick: decimal.MustParse("0.5")},
+		),
+		WithLotSize(decimal.New(10, 0)),
+		WithOrderQtyLimits(decimal.New(20, 0), decimal.New(1000, 0)),
+		WithMaxNotional(decimal.New(50000, 0)),
+	)
+
+	processLine(ob, "1	L	B	20	99.5	0	N")
+	processLine(ob, "2	L	B	20	99.2	0	N")
+	processLine(ob, "3	L	S	20	105	0	N")
+	processLine(ob, "4	L	S	20	102	0	N")
+	processLine(ob, "5	L	S	25	110	0	N")
+	processLine(ob, "6	L	S	10	110	0	N")
+	processLine(ob, "7	L	S	1010	110	0	N")
+	processLine(ob, "8	L	S	460	110	0	N")
+	processLine(ob, "9	M	B	460	0	0	N")
+	processLine(ob, "10	M	B	460	0	112	SL")
+	processLine(ob, "11	M	B	460	0	120	SL")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 20",
+		"CreateOrder Rejected 2 20 ErrTickSize",
+		"CreateOrder Accepted 3 20",
+		"CreateOrder Rejected 4 20 ErrTickSize",
+		"CreateOrder Rejected 5 25 ErrLotSize",
+		"CreateOrder Rejected 6 10 ErrQtyOutOfRange",
+		"CreateOrder Rejected 7 1010 ErrQtyOutOfRange",
+		"CreateOrder Rejected 8 460 ErrMaxNotional",
+		"CreateOrder Accepted 9 460",
+		"3 9 FilledComplete FilledPartial 20 105",
+		"CreateOrder Canceled 9 440",
+		"CreateOrder Rejected 10 460 ErrTickSize",
+		"CreateOrder Rejected 11 460 ErrMaxNotional",
+	})
+
+	n.Reset()
+	ob.ModifyOrder(tok, 1, decimal.New(30, 0), decimal.New(98, 0))
+	tok++
+	ob.ModifyOrder(tok, 1, decimal.New(30, 0), decimal.MustParse("98.25"))
+	tok++
+	ob.ModifyOrder(tok, 1, decimal.New(35, 0), decimal.New(98, 0))
+	tok++
+	ob.ModifyOrder(tok, 1, decimal.New(1010, 0), decimal.New(98, 0))
+	tok++
+	ob.AddOrderWithAttrs(tok, 12, Limit, Sell, decimal.New(100, 0), decimal.New(200, 0), decimal.Zero, None, OrderAttrs{
+		DisplayQty: decimal.New(15, 0),
+	})
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 1 30",
+		"ModifyOrder Rejected 1 30 ErrTickSize",
+		"ModifyOrder Rejected 1 35 ErrLotSize",
+		"ModifyOrder Rejected 1 1010 ErrQtyOutOfRange",
+		"CreateOrder Rejected 12 100 ErrLotSize",
+	})
+}
+
+func TestInstrument_GeneratedPrices(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n,
+		WithTickTable(TickBand{From: decimal.Zero, Tick: decimal.New(5, 0)}),
+		WithPostOnlySlide(decimal.New(3, 0)),
+		WithDynamicBand(Band{Offset: decimal.MustParse("0.07"), Percent: true}),
+		WithCollarAction(CollarRest),
+	)
+
+	processLine(ob, "1	L	S	10	100	0	N")
+	processLine(ob, "2	L	B	10	80	0	N")
+
+	// Post-only orders slide to the tick behind the slide price
+	processLine(ob, "3	L	B	10	100	0	P")
+	processLine(ob, "4	L	S	10	90	0	P")
+	assert.Equal(t, decimal.New(95, 0), ob.Order(3).Price)
+	assert.Equal(t, decimal.New(100, 0), ob.Order(4).Price)
+
+	// Percent trailing stops trigger on the tick away from the last price
+	processLine(ob, "5	M	B	1	0	0	N")
+	addTrailingStop(ob, 6, Market, Sell, 1, 0, TrailPercent, decimal.MustParse("0.03"))
+	assert.Equal(t, decimal.New(95, 0), ob.Order(6).TrigPrice)
+
+	// The remainder rests on the tick inside the percent band
+	processLine(ob, "7	L	S	5	110	0	N")
+	n.Reset()
+	processLine(ob, "8	L	B	30	120	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 8 30",
+		"1 8 FilledComplete FilledPartial 9 100",
+		"4 8 FilledComplete FilledPartial 10 100",
+	})
+	assert.Equal(t, decimal.New(105, 0), ob.Order(8).Price)
+}
@@ -0,0 +1,352 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// journal command types
+const (
+	cmdAddOrder byte = iota + 1
+	cmdCancelOrder
+	cmdModifyOrder
+	cmdAdvanceTime
+	cmdToken // Ask and Bid only consume a token
+	cmdUncross
+	cmdSetState
+	cmdSetReference
+)
+
+// maxFrameSize bounds the payload of a journal frame and of a snapshot order
+// so that a corrupt length cannot make the reader allocate unbounded memory
+const maxFrameSize = 4096
+
+// Journal records every token consuming call of an order book so that the book
+// can be rebuilt with Replay.
+//
+// Each call is appended as a frame made of the uvarint length of the payload,
+// the payload and its little endian CRC32. The payload is the command type and
+// token followed by the arguments of the call.
+//
+// Commands are buffered; call Flush to write them to the underlying writer.
+// Write errors are sticky and returned by Flush and Err.
+type Journal struct {
+	w   *bufio.Writer
+	buf bytes.Buffer // payload of the command being written
+	err error
+}
+
+// NewJournal creates a journal that appends commands to w
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: bufio.NewWriter(w)}
+}
+
+// Flush writes the buffered commands to the underlying writer
+func (j *Journal) Flush() error {
+	if j.err != nil {
+		return j.err
+	}
+
+	j.err = j.w.Flush()
+	return j.err
+}
+
+// Err returns the first error encountered while writing the journal
+func (j *Journal) Err() error {
+	return j.err
+}
+
+func (j *Journal) addOrder(tok, id uint64, class ClassType, side SideType, qty, price, trigPrice decimal.Decimal, flag FlagType, attrs OrderAttrs) {
+	j.begin(cmdAddOrder, tok)
+	j.uvarint(id)
+	j.buf.WriteByte(byte(class))
+	j.buf.WriteByte(byte(side))
+	j.buf.WriteByte(byte(flag))
+	qty.WriteTo(&j.buf)
+	price.WriteTo(&j.buf)
+	trigPrice.WriteTo(&j.buf)
+
+	attrs.DisplayQty.WriteTo(&j.buf)
+	j.uvarint(attrs.Owner)
+	j.buf.WriteByte(byte(attrs.TIF))
+	j.varint(attrs.ExpireAt)
+	j.buf.WriteByte(byte(attrs.TrailType))
+	attrs.TrailOffset.WriteTo(&j.buf)
+	j.uvarint(attrs.Group)
+	j.uvarint(attrs.Parent)
+	j.commit()
+}
+
+func (j *Journal) cancelOrder(tok, id uint64) {
+	j.begin(cmdCancelOrder, tok)
+	j.uvarint(id)
+	j.commit()
+}
+
+func (j *Journal) modifyOrder(tok, id uint64, qty, price decimal.Decimal) {
+	j.begin(cmdModifyOrder, tok)
+	j.uvarint(id)
+	qty.WriteTo(&j.buf)
+	price.WriteTo(&j.buf)
+	j.commit()
+}
+
+func (j *Journal) advanceTime(tok uint64, now int64) {
+	j.begin(cmdAdvanceTime, tok)
+	j.varint(now)
+	j.commit()
+}
+
+func (j *Journal) token(tok uint64) {
+	j.begin(cmdToken, tok)
+	j.commit()
+}
+
+func (j *Journal) uncross(tok uint64) {
+	j.begin(cmdUncross, tok)
+	j.commit()
+}
+
+func (j *Journal) setState(tok uint64, state SessionState) {
+	j.begin(cmdSetState, tok)
+	j.buf.WriteByte(byte(state))
+	j.commit()
+}
+
+func (j *Journal) setReference(tok uint64, price decimal.Decimal) {
+	j.begin(cmdSetReference, tok)
+	price.WriteTo(&j.buf)
+	j.commit()
+}
+
+func (j *Journal) begin(cmd byte, tok uint64) {
+	j.buf.Reset()
+	j.buf.WriteByte(cmd)
+	j.uvarint(tok)
+}
+
+// commit frames the current payload and appends it to the journal
+func (j *Journal) commit() {
+	if j.err != nil {
+		return
+	}
+
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(j.buf.Len()))
+	j.w.Write(b[:n])
+	j.w.Write(j.buf.Bytes())
+
+	binary.LittleEndian.PutUint32(b[:4], crc32.ChecksumIEEE(j.buf.Bytes()))
+	if _, err := j.w.Write(b[:4]); err != nil {
+		j.err = err
+	}
+}
+
+func (j *Journal) uvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	j.buf.Write(b[:n])
+}
+
+func (j *Journal) varint(x int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], x)
+	j.buf.Write(b[:n])
+}
+
+// Replay applies the commands of a journal written by Journal to ob.
+//
+// Commands whose token was already consumed by ob are skipped, so a journal
+// can be replayed on top of a book restored from a snapshot taken while the
+// journal was being written. Replay returns nil at the end of the journal,
+// io.ErrUnexpectedEOF if the last frame is truncated and ErrInvalidJournal if
+// a frame is corrupt or a token is missing. The commands are not journaled
+// again while replaying.
+func Replay(r io.Reader, ob *OrderBook) error {
+	j := ob.journal
+	ob.journal = nil
+	defer func() { ob.journal = j }()
+
+	br := bufio.NewReader(r)
+	var payload []byte
+	var sum [4]byte
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if size > maxFrameSize {
+			return ErrInvalidJournal
+		}
+
+		if uint64(cap(payload)) < size {
+			payload = make([]byte, size)
+		}
+		payload = payload[:size]
+
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return unexpectedEOF(err)
+		}
+		if _, err := io.ReadFull(br, sum[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+
+		if binary.LittleEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(payload) {
+			return ErrInvalidJournal
+		}
+
+		if err := ob.apply(payload); err != nil {
+			return err
+		}
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// apply decodes a journaled command and calls the matching method of ob
+func (ob *OrderBook) apply(payload []byte) error {
+	r := bytes.NewReader(payload)
+
+	cmd, err := r.ReadByte()
+	if err != nil {
+		return ErrInvalidJournal
+	}
+
+	tok, err := binary.ReadUvarint(r)
+	if err != nil {
+		return ErrInvalidJournal
+	}
+
+	if tok <= ob.lastToken {
+		return nil
+	}
+	if tok != ob.lastToken+1 {
+		return ErrInvalidJournal
+	}
+
+	d := journalDecoder{r: r}
+	switch cmd {
+	case cmdAddOrder:
+		id := d.uvarint()
+		class, side, flag := ClassType(d.byte()), SideType(d.byte()), FlagType(d.byte())
+		qty, price, trigPrice := d.decimal(), d.decimal(), d.decimal()
+
+		var attrs OrderAttrs
+		attrs.DisplayQty = d.decimal()
+		attrs.Owner = d.uvarint()
+		attrs.TIF = TimeInForce(d.byte())
+		attrs.ExpireAt = d.varint()
+		attrs.TrailType = TrailType(d.byte())
+		attrs.TrailOffset = d.decimal()
+		attrs.Group = d.uvarint()
+		attrs.Parent = d.uvarint()
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.AddOrderWithAttrs(tok, id, class, side, qty, price, trigPrice, flag, attrs)
+	case cmdCancelOrder:
+		id := d.uvarint()
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.CancelOrder(tok, id)
+	case cmdModifyOrder:
+		id := d.uvarint()
+		qty, price := d.decimal(), d.decimal()
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.ModifyOrder(tok, id, qty, price)
+	case cmdAdvanceTime:
+		now := d.varint()
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.AdvanceTime(tok, now)
+	case cmdToken:
+		ob.Ask(tok)
+	case cmdUncross:
+		ob.Uncross(tok)
+	case cmdSetState:
+		state := SessionState(d.byte())
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.SetState(tok, state)
+	case cmdSetReference:
+		price := d.decimal()
+		if d.err != nil {
+			return ErrInvalidJournal
+		}
+
+		ob.SetReferencePrice(tok, price)
+	default:
+		return ErrInvalidJournal
+	}
+
+	return nil
+}
+
+// journalDecoder reads the arguments of a command, keeping the first error
+type journalDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *journalDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	b, err := d.r.ReadByte()
+	d.err = err
+	return b
+}
+
+func (d *journalDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	x, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return x
+}
+
+func (d *journalDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	x, err := binary.ReadVarint(d.r)
+	d.err = err
+	return x
+}
+
+func (d *journalDecoder) decimal() decimal.Decimal {
+	if d.err != nil {
+		return decimal.Zero
+	}
+
+	x, err := decimal.ReadFrom(d.r)
+	d.err = err
+	return x
+}
@@ -0,0 +1,124 @@
+package orderbook
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journalCommands runs a mix of every journaled call against ob
+func journalCommands(ob *OrderBook) {
+	addDepth(ob, 0)
+	processLine(ob, "100	M	B	1	0	0	N")
+	processLine(ob, "101	L	S	1	90	90	SL")
+	addIceberg(ob, 102, Buy, 10, 3, 95)
+	addTrailingStop(ob, 103, Market, Sell, 2, 0, TrailAbsolute, decimal.New(5, 0))
+	addLinkedOrder(ob, 104, Limit, Buy, 1, 80, 0, None, 1, 0)
+	addLinkedOrder(ob, 105, Limit, Sell, 1, 120, 0, None, 1, 0)
+	addTIFOrder(ob, 106, Buy, 1, 85, GTD, at(10, 0))
+	ob.CancelOrder(tok, 6)
+	tok++
+	ob.ModifyOrder(tok, 102, decimal.New(6, 0), decimal.New(96, 0))
+	tok++
+	ob.Ask(tok)
+	tok++
+	ob.Bid(tok)
+	tok++
+	advanceTime(ob, at(11, 0))
+	processLine(ob, "107	M	S	4	0	0	N")
+	processLine(ob, "108	L	B	3	110	0	N")
+}
+
+func TestJournal_Replay(t *testing.T) {
+	var journal bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithJournal(j))
+	journalCommands(ob)
+	require.NoError(t, j.Flush())
+
+	rn := &Notification{}
+	rob := NewOrderBook(rn)
+	require.NoError(t, Replay(bytes.NewReader(journal.Bytes()), rob))
+
+	require.NotEmpty(t, n.Strings())
+	assert.Equal(t, n.Strings(), rn.Strings())
+	assert.Equal(t, ob.lastToken, rob.lastToken)
+
+	var snap, rsnap bytes.Buffer
+	require.NoError(t, ob.Snapshot(&snap))
+	require.NoError(t, rob.Snapshot(&rsnap))
+	assert.Equal(t, snap.Bytes(), rsnap.Bytes())
+}
+
+func TestJournal_ReplayAfterSnapshot(t *testing.T) {
+	var journal, snap bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithJournal(j))
+	addDepth(ob, 0)
+	processLine(ob, "100	M	B	1	0	0	N")
+	require.NoError(t, ob.Snapshot(&snap))
+
+	n.Reset()
+	processLine(ob, "101	L	S	1	90	90	SL")
+	processLine(ob, "102	M	S	3	0	0	N")
+	ob.CancelOrder(tok, 7)
+	tok++
+	require.NoError(t, j.Flush())
+
+	// The restored book skips the commands that are already in the snapshot
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(&snap, rn)
+	require.NoError(t, err)
+	require.NoError(t, Replay(bytes.NewReader(journal.Bytes()), rob))
+
+	require.NotEmpty(t, n.Strings())
+	assert.Equal(t, n.Strings(), rn.Strings())
+	assert.Equal(t, ob.lastToken, rob.lastToken)
+}
+
+func TestJournal_Corrupt(t *testing.T) {
+	var journal bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	ob := NewOrderBook(&EmptyNotification{}, WithJournal(j))
+	addDepth(ob, 0)
+	require.NoError(t, j.Flush())
+	b := journal.Bytes()
+
+	truncated := b[:len(b)-2]
+	assert.Equal(t, io.ErrUnexpectedEOF, Replay(bytes.NewReader(truncated), NewOrderBook(&EmptyNotification{})))
+
+	corrupt := append([]byte(nil), b...)
+	corrupt[3] ^= 0xff
+	assert.Equal(t, ErrInvalidJournal, Replay(bytes.NewReader(corrupt), NewOrderBook(&EmptyNotification{})))
+
+	// A corrupt length does not allocate the frame
+	huge := append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, b...)
+	assert.Equal(t, ErrInvalidJournal, Replay(bytes.NewReader(huge), NewOrderBook(&EmptyNotification{})))
+
+	// Commands that a book has already applied are skipped
+	rob := NewOrderBook(&EmptyNotification{})
+	rob.lastToken = 100
+	assert.NoError(t, Replay(bytes.NewReader(b), rob))
+	assert.Nil(t, rob.Bid(101))
+
+	// A journal that starts after the book's last token has a gap
+	var late bytes.Buffer
+	lj := NewJournal(&late)
+	lob := NewOrderBook(&EmptyNotification{}, WithJournal(lj))
+	lob.lastToken = 4
+	lob.Ask(5)
+	require.NoError(t, lj.Flush())
+	assert.Equal(t, ErrInvalidJournal, Replay(&late, NewOrderBook(&EmptyNotification{})))
+}
@@ -0,0 +1,188 @@
+package orderbook
+
+import (
+	"iter"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// Book selects a set of orders of the order book
+type Book byte
+
+const (
+	// BidBook holds resting buy orders, highest price first
+	BidBook Book = iota
+	// AskBook holds resting sell orders, lowest price first
+	AskBook
+	// TriggerOverBook holds stop buy and take profit sell orders, lowest
+	// trigger price first
+	TriggerOverBook
+	// TriggerUnderBook holds stop sell and take profit buy orders, highest
+	// trigger price first
+	TriggerUnderBook
+	// MarketBidBook holds market buy orders collected during an auction, in
+	// time priority
+	MarketBidBook
+	// MarketAskBook holds market sell orders collected during an auction, in
+	// time priority
+	MarketAskBook
+	// HeldBook holds bracket exits waiting for their entry to fill, grouped
+	// by entry id
+	HeldBook
+)
+
+// String implements fmt.Stringer interface
+func (b Book) String() string {
+	switch b {
+	case BidBook:
+		return "BidBook"
+	case AskBook:
+		return "AskBook"
+	case TriggerOverBook:
+		return "TriggerOverBook"
+	case TriggerUnderBook:
+		return "TriggerUnderBook"
+	case MarketBidBook:
+		return "MarketBidBook"
+	case MarketAskBook:
+		return "MarketAskBook"
+	case HeldBook:
+		return "HeldBook"
+	default:
+		return ""
+	}
+}
+
+// level returns the price level of book and whether it is walked from the
+// highest price down
+func (ob *OrderBook) level(book Book) (pl *priceLevel, desc bool) {
+	switch book {
+	case BidBook:
+		return ob.bids, true
+	case AskBook:
+		return ob.asks, false
+	case TriggerOverBook:
+		return ob.triggerOver, false
+	case TriggerUnderBook:
+		return ob.triggerUnder, true
+	default:
+		panic("invalid book")
+	}
+}
+
+// Orders returns an iterator over every order of book in price-time priority,
+// i.e. in the order they would match or trigger. Trigger orders are ordered by
+// trigger price. Market and held orders are not kept in price levels and are
+// yielded in the order they were added.
+//
+// The iterator yields copies of the orders. It does not consume a token and
+// the order book must not be modified while iterating.
+func (ob *OrderBook) Orders(book Book) iter.Seq[Order] {
+	if book >= MarketBidBook {
+		return ob.unpriced(book, func(*Order) bool { return true })
+	}
+
+	pl, desc := ob.level(book)
+
+	return func(yield func(Order) bool) {
+		it := pl.priceTree.Iterator()
+		step := it.Next
+		if desc {
+			it.End()
+			step = it.Prev
+		}
+
+		for step() {
+			if !yieldQueue(it.Value(), yield) {
+				return
+			}
+		}
+	}
+}
+
+// OrdersBetween is like Orders but only yields the orders priced between low
+// and high inclusive. Price levels outside of the range are not visited.
+// Orders without a price, such as collected market orders, are never in range.
+func (ob *OrderBook) OrdersBetween(book Book, low, high decimal.Decimal) iter.Seq[Order] {
+	if book >= MarketBidBook {
+		return ob.unpriced(book, func(o *Order) bool {
+			return !o.Price.IsZero() && !o.Price.LessThan(low) && !o.Price.GreaterThan(high)
+		})
+	}
+
+	pl, desc := ob.level(book)
+
+	return func(yield func(Order) bool) {
+		find, from := pl.priceTree.Ceiling, low
+		if desc {
+			find, from = pl.priceTree.Floor, high
+		}
+
+		node, ok := find(from)
+		if !ok {
+			return
+		}
+
+		it := pl.priceTree.IteratorAt(node)
+		step := it.Next
+		if desc {
+			step = it.Prev
+		}
+
+		for ok := true; ok; ok = step() {
+			q := it.Value()
+			if q.price.LessThan(low) || q.price.GreaterThan(high) {
+				return
+			}
+
+			if !yieldQueue(q, yield) {
+				return
+			}
+		}
+	}
+}
+
+// unpriced returns an iterator over the orders of a book that is not kept in
+// a price level, skipping those rejected by keep
+func (ob *OrderBook) unpriced(book Book, keep func(*Order) bool) iter.Seq[Order] {
+	return func(yield func(Order) bool) {
+		if book == HeldBook {
+			for it := ob.held.Iterator(); it.Next(); {
+				for _, o := range it.Value() {
+					if keep(o) && !yield(orderCopy(o)) {
+						return
+					}
+				}
+			}
+			return
+		}
+
+		q := &ob.marketBids
+		if book == MarketAskBook {
+			q = &ob.marketAsks
+		}
+		for o := q.Head(); o != nil; o = o.next {
+			if keep(o) && !yield(orderCopy(o)) {
+				return
+			}
+		}
+	}
+}
+
+// yieldQueue yields copies of the orders of q in queue order
+func yieldQueue(q *orderQueue, yield func(Order) bool) bool {
+	for o := q.Head(); o != nil; o = o.next {
+		if !yield(orderCopy(o)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orderCopy returns a copy of o detached from its queue
+func orderCopy(o *Order) Order {
+	c := *o
+	c.queue, c.prev, c.next = nil, nil, nil
+	return c
+}
@@ -0,0 +1,71 @@
+package orderbook
+
+import (
+	"iter"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func orderIDs(seq iter.Seq[Order]) (ids []uint64) {
+	for o := range seq {
+		ids = append(ids, o.ID)
+	}
+	return
+}
+
+func TestOrders(t *testing.T) {
+	_, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	2	90	0	N")
+	processLine(ob, "2	L	B	1	80	0	N")
+	processLine(ob, "3	L	B	3	90	0	N")
+	processLine(ob, "4	L	B	1	70	0	N")
+	processLine(ob, "5	L	S	1	110	0	N")
+	processLine(ob, "6	L	S	1	100	0	N")
+	processLine(ob, "7	L	S	1	110	0	N")
+	processLine(ob, "8	M	B	1	0	0	N") // @ LP 100
+	processLine(ob, "9	M	B	1	0	120	SL")
+	processLine(ob, "10	M	B	1	0	105	SL")
+	processLine(ob, "11	M	S	1	0	85	SL")
+	processLine(ob, "12	M	S	1	0	95	SL")
+
+	assert.Equal(t, []uint64{1, 3, 2, 4}, orderIDs(ob.Orders(BidBook)))
+	assert.Equal(t, []uint64{5, 7}, orderIDs(ob.Orders(AskBook)))
+	assert.Equal(t, []uint64{10, 9}, orderIDs(ob.Orders(TriggerOverBook)))
+	assert.Equal(t, []uint64{12, 11}, orderIDs(ob.Orders(TriggerUnderBook)))
+
+	assert.Equal(t, []uint64{1, 3, 2}, orderIDs(ob.OrdersBetween(BidBook, decimal.New(75, 0), decimal.New(95, 0))))
+	assert.Equal(t, []uint64{2}, orderIDs(ob.OrdersBetween(BidBook, decimal.New(80, 0), decimal.New(80, 0))))
+	assert.Empty(t, orderIDs(ob.OrdersBetween(BidBook, decimal.New(100, 0), decimal.New(200, 0))))
+	assert.Equal(t, []uint64{5, 7}, orderIDs(ob.OrdersBetween(AskBook, decimal.New(101, 0), decimal.New(200, 0))))
+	assert.Equal(t, []uint64{10}, orderIDs(ob.OrdersBetween(TriggerOverBook, decimal.Zero, decimal.New(110, 0))))
+
+	// Early termination
+	for o := range ob.Orders(BidBook) {
+		assert.Equal(t, uint64(1), o.ID)
+		assert.Equal(t, decimal.New(2, 0), o.Qty)
+		break
+	}
+}
+
+func TestOrders_Unpriced(t *testing.T) {
+	_, ob := getAuctionOrderBook()
+	processLine(ob, "1	L	B	1	90	0	N")
+	processLine(ob, "2	M	B	1	0	0	N")
+	processLine(ob, "3	M	S	2	0	0	N")
+	processLine(ob, "4	M	B	1	0	0	N")
+	addLinkedOrder(ob, 5, Limit, Sell, 1, 120, 0, None, 0, 1)
+	addLinkedOrder(ob, 6, Market, Sell, 1, 0, 80, StopLoss, 0, 1)
+
+	assert.Equal(t, []uint64{2, 4}, orderIDs(ob.Orders(MarketBidBook)))
+	assert.Equal(t, []uint64{3}, orderIDs(ob.Orders(MarketAskBook)))
+	assert.Equal(t, []uint64{5, 6}, orderIDs(ob.Orders(HeldBook)))
+	assert.Equal(t, []uint64{5}, orderIDs(ob.OrdersBetween(HeldBook, decimal.New(100, 0), decimal.New(200, 0))))
+	assert.Empty(t, orderIDs(ob.OrdersBetween(MarketBidBook, decimal.Zero, decimal.New(200, 0))))
+
+	// Depth only aggregates priced orders resting in the book
+	bids, asks := ob.Depth(10)
+	assert.Equal(t, []DepthLevel{{Price: decimal.New(90, 0), Qty: decimal.New(1, 0), VisibleQty: decimal.New(1, 0), Orders: 1}}, bids)
+	assert.Empty(t, asks)
+}
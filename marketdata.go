@@ -0,0 +1,81 @@
+package orderbook
+
+import (
+	decimal "github.com/geseq/udecimal"
+)
+
+// MarketDataHandler receives incremental changes of the bids and asks. Every
+// event carries a sequence number that is one higher than that of the
+// previous event, so that gaps can be detected downstream.
+//
+// Quantities are displayed quantities; the hidden reserve of iceberg orders
+// is never published. Trigger orders are not part of the feed until they
+// trigger and rest in the book.
+type MarketDataHandler interface {
+	// PutLevel reports the new aggregate quantity and order count of a
+	// price level. Both are zero when the level was removed.
+	PutLevel(seq uint64, action UpdateAction, side SideType, price, qty decimal.Decimal, orders uint64)
+
+	// PutOrderUpdate reports a resting order that was added, changed in
+	// place or deleted. An order that is added goes to the back of its
+	// price level.
+	PutOrderUpdate(seq uint64, action UpdateAction, side SideType, orderID uint64, price, qty decimal.Decimal)
+}
+
+// UpdateAction of a market data event
+type UpdateAction byte
+
+const (
+	ActionAdd UpdateAction = iota
+	ActionChange
+	ActionDelete
+)
+
+// String implements fmt.Stringer interface
+func (a UpdateAction) String() string {
+	switch a {
+	case ActionAdd:
+		return "Add"
+	case ActionChange:
+		return "Change"
+	case ActionDelete:
+		return "Delete"
+	default:
+		return ""
+	}
+}
+
+// marketData numbers and publishes the changes of the bids and asks
+type marketData struct {
+	handler MarketDataHandler
+	seq     uint64
+}
+
+// order publishes a change of an order resting in pl
+func (md *marketData) order(pl *priceLevel, action UpdateAction, o *Order) {
+	md.seq++
+	md.handler.PutOrderUpdate(md.seq, action, pl.side(), o.ID, o.Price, o.Visible())
+}
+
+// level publishes the state of the price level q belongs to after a change.
+// added is true if q was created by the change.
+func (md *marketData) level(pl *priceLevel, q *orderQueue, added bool) {
+	md.seq++
+
+	switch {
+	case q.Len() == 0:
+		md.handler.PutLevel(md.seq, ActionDelete, pl.side(), q.Price(), decimal.Zero, 0)
+	case added:
+		md.handler.PutLevel(md.seq, ActionAdd, pl.side(), q.Price(), q.VisibleQty(), q.Len())
+	default:
+		md.handler.PutLevel(md.seq, ActionChange, pl.side(), q.Price(), q.VisibleQty(), q.Len())
+	}
+}
+
+// side returns the side of the orders of a bid or ask price level
+func (pl *priceLevel) side() SideType {
+	if pl.priceType == BidPrice {
+		return Buy
+	}
+	return Sell
+}
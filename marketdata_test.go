@@ -0,0 +1,97 @@
+package orderbook
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mdRecorder struct {
+	seq    uint64
+	events []string
+}
+
+func (r *mdRecorder) next(seq uint64) {
+	if seq != r.seq+1 {
+		panic(fmt.Sprintf("sequence gap: %d after %d", seq, r.seq))
+	}
+	r.seq = seq
+}
+
+func (r *mdRecorder) PutLevel(seq uint64, action UpdateAction, side SideType, price, qty decimal.Decimal, orders uint64) {
+	r.next(seq)
+	r.events = append(r.events, fmt.Sprintf("L %s %s %s %s %d", action, side, price, qty, orders))
+}
+
+func (r *mdRecorder) PutOrderUpdate(seq uint64, action UpdateAction, side SideType, orderID uint64, price, qty decimal.Decimal) {
+	r.next(seq)
+	r.events = append(r.events, fmt.Sprintf("O %s %s %d %s %s", action, side, orderID, price, qty))
+}
+
+func TestMarketData(t *testing.T) {
+	md := &mdRecorder{}
+	ob := NewOrderBook(&EmptyNotification{}, WithMarketDataHandler(md))
+	tok = 1
+
+	processLine(ob, "1	L	B	2	90	0	N")
+	processLine(ob, "2	L	B	3	90	0	N")
+	addIceberg(ob, 3, Sell, 10, 2, 100)
+	processLine(ob, "4	M	S	3	0	0	N")
+	processLine(ob, "5	L	B	3	100	0	N")
+	ob.ModifyOrder(tok, 2, decimal.New(1, 0), decimal.New(90, 0))
+	tok++
+	ob.CancelOrder(tok, 2)
+	tok++
+	processLine(ob, "6	M	B	1	0	120	SL")
+
+	assert.Equal(t, []string{
+		"O Add buy 1 90 2",
+		"L Add buy 90 2 1",
+		"O Add buy 2 90 3",
+		"L Change buy 90 5 2",
+		"O Add sell 3 100 2",
+		"L Add sell 100 2 1",
+		// 4 sells 3: fills 1 and part of 2
+		"O Delete buy 1 90 2",
+		"L Change buy 90 3 1",
+		"O Change buy 2 90 2",
+		"L Change buy 90 2 1",
+		// 5 buys 3 @ 100: replenishes the iceberg once
+		"O Delete sell 3 100 2",
+		"O Add sell 3 100 2",
+		"L Change sell 100 2 1",
+		"O Change sell 3 100 1",
+		"L Change sell 100 1 1",
+		// amend and cancel 2
+		"O Change buy 2 90 1",
+		"L Change buy 90 1 1",
+		"O Delete buy 2 90 1",
+		"L Delete buy 90 0 0",
+	}, md.events)
+}
+
+func TestMarketData_Snapshot(t *testing.T) {
+	md := &mdRecorder{}
+	ob := NewOrderBook(&EmptyNotification{}, WithMarketDataHandler(md))
+	tok = 1
+	processLine(ob, "1	L	B	2	90	0	N")
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	rmd := &mdRecorder{seq: md.seq}
+	rob, err := RestoreOrderBook(&buf, &EmptyNotification{}, WithMarketDataHandler(rmd))
+	require.NoError(t, err)
+	assert.Empty(t, rmd.events)
+
+	processLine(rob, "2	M	S	1	0	0	N")
+	assert.Equal(t, []string{
+		"O Change buy 1 90 1",
+		"L Change buy 90 1 1",
+	}, rmd.events)
+	assert.Equal(t, uint64(4), rmd.seq)
+}
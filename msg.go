@@ -3,6 +3,8 @@ package orderbook
 const (
 	MsgCreateOrder MsgType = iota
 	MsgCancelOrder
+	MsgModifyOrder
+	MsgSelfTrade
 )
 
 // String implements fmt.Stringer interface
@@ -12,6 +14,10 @@ func (c MsgType) String() string {
 		return "CreateOrder"
 	case MsgCancelOrder:
 		return "CancelOrder"
+	case MsgModifyOrder:
+		return "ModifyOrder"
+	case MsgSelfTrade:
+		return "SelfTrade"
 	default:
 		return ""
 	}
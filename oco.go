@@ -0,0 +1,231 @@
+package orderbook
+
+import (
+	local_tree "github.com/geseq/orderbook/pkg/tree"
+	decimal "github.com/geseq/udecimal"
+)
+
+// newGroupTree creates the tree that maps an OCO group to the IDs of its legs
+func newGroupTree(poolSize uint64) *local_tree.Tree[uint64, []uint64] {
+	return local_tree.NewWithPool(Uint64Cmp, local_tree.NewNodePool[uint64, []uint64](poolSize))
+}
+
+// newHeldTree creates the tree that maps a bracket entry to its held exits
+func newHeldTree(poolSize uint64) *local_tree.Tree[uint64, []*Order] {
+	return local_tree.NewWithPool(Uint64Cmp, local_tree.NewNodePool[uint64, []*Order](poolSize))
+}
+
+// joinGroup registers o as a leg of its OCO group. Legs are kept in ID order
+// so the other legs are canceled in the same order after a restore.
+func (ob *OrderBook) joinGroup(o *Order) {
+	if o.Group == 0 {
+		return
+	}
+
+	ids, _ := ob.groups.Get(o.Group)
+	i := len(ids)
+	for i > 0 && ids[i-1] > o.ID {
+		i--
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = o.ID
+	ob.groups.Put(o.Group, ids)
+}
+
+// leaveGroup removes o from its OCO group without affecting the other legs
+func (ob *OrderBook) leaveGroup(o *Order) {
+	group := o.Group
+	if group == 0 {
+		return
+	}
+	o.Group = 0
+
+	ids, ok := ob.groups.Get(group)
+	if !ok {
+		return
+	}
+
+	for i, id := range ids {
+		if id == o.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+
+	if len(ids) == 0 {
+		ob.groups.Remove(group)
+		return
+	}
+	ob.groups.Put(group, ids)
+}
+
+// fireGroup is called when o fills or triggers. The other legs of its group
+// are marked so that they no longer match and are canceled by processLinked
+// before the current call returns. o itself is no longer linked afterwards.
+func (ob *OrderBook) fireGroup(o *Order) {
+	group := o.Group
+	if group == 0 {
+		return
+	}
+	o.Group = 0
+
+	ids, ok := ob.groups.Get(group)
+	if !ok {
+		return
+	}
+	ob.groups.Remove(group)
+
+	for _, id := range ids {
+		if id == o.ID {
+			continue
+		}
+
+		if leg := ob.Order(id); leg != nil && leg.Group == group {
+			leg.canceled = true
+			ob.linked = append(ob.linked, leg)
+		}
+	}
+}
+
+// fireGroups fires the groups of both sides of a trade
+func (ob *OrderBook) fireGroups(maker, taker *Order) {
+	if maker.Group != 0 {
+		ob.fireGroup(maker)
+	}
+	if taker.Group != 0 {
+		ob.fireGroup(taker)
+	}
+}
+
+// hold parks a bracket exit until its entry is filled entirely
+func (ob *OrderBook) hold(o *Order) {
+	exits, _ := ob.held.Get(o.Parent)
+	ob.held.Put(o.Parent, append(exits, o))
+	ob.heldOrders.put(o.ID, o)
+	ob.trackExpiry(o)
+}
+
+// cancelHeld removes a held bracket exit from its entry
+func (ob *OrderBook) cancelHeld(orderID uint64) *Order {
+	o, ok := ob.heldOrders.remove(orderID)
+	if !ok {
+		return nil
+	}
+
+	exits, _ := ob.held.Get(o.Parent)
+	for i, e := range exits {
+		if e == o {
+			exits = append(exits[:i], exits[i+1:]...)
+			break
+		}
+	}
+
+	if len(exits) == 0 {
+		ob.held.Remove(o.Parent)
+	} else {
+		ob.held.Put(o.Parent, exits)
+	}
+	return o
+}
+
+// filled is called when o was filled entirely. The held exits of a bracket
+// entry are queued for activation by processLinked.
+func (ob *OrderBook) filled(o *Order) {
+	if ob.held.Empty() {
+		return
+	}
+
+	exits, ok := ob.held.Get(o.ID)
+	if !ok {
+		return
+	}
+	ob.held.Remove(o.ID)
+
+	for _, e := range exits {
+		ob.heldOrders.remove(e.ID)
+		ob.activated = append(ob.activated, e)
+	}
+}
+
+// release returns an order that left the book to the pool. An order that is
+// released without being filled entirely leaves its OCO group and takes the
+// held exits of its bracket with it.
+func (ob *OrderBook) release(o *Order) {
+	ob.leaveGroup(o)
+	ob.cancelExits(o)
+	o.Release()
+}
+
+// cancelExits cancels the held exits of o, which can no longer be filled
+// entirely
+func (ob *OrderBook) cancelExits(o *Order) {
+	if ob.held.Empty() {
+		return
+	}
+
+	exits, ok := ob.held.Get(o.ID)
+	if !ok {
+		return
+	}
+	ob.held.Remove(o.ID)
+
+	for _, e := range exits {
+		ob.heldOrders.remove(e.ID)
+		ob.putOrder(MsgCancelOrder, Canceled, e, e.Qty, decimal.Zero, ReasonLinked, ErrLinkedOrder)
+		e.Release()
+	}
+}
+
+// processLinked cancels the remaining legs of fired OCO groups and activates
+// the exits of filled bracket entries. It is called from processOrder, so
+// everything happens within the call that caused the fill or trigger.
+func (ob *OrderBook) processLinked() {
+	for len(ob.linked) > 0 {
+		o := ob.linked[0]
+		ob.linked[0] = nil
+		ob.linked = ob.linked[1:]
+
+		// Legs that are no longer in the book are either the current taker
+		// or queued triggers, which check the canceled mark themselves
+		if o.canceled && ob.cancelOrder(o.ID) == o {
+			ob.cancelLinked(o)
+		}
+	}
+
+	for len(ob.activated) > 0 {
+		o := ob.activated[0]
+		ob.activated[0] = nil
+		ob.activated = ob.activated[1:]
+
+		ob.activate(o)
+	}
+}
+
+// cancelLinked notifies the cancellation of an OCO leg and releases it
+func (ob *OrderBook) cancelLinked(o *Order) {
+	ob.putOrder(MsgCancelOrder, Canceled, o, o.Qty, decimal.Zero, ReasonLinked, ErrLinkedOrder)
+	ob.release(o)
+}
+
+// activate places a bracket exit whose entry was filled
+func (ob *OrderBook) activate(o *Order) {
+	ob.joinGroup(o)
+
+	if o.Flag&(StopLoss|TakeProfit) != 0 {
+		ob.addTrigOrder(o)
+		return
+	}
+
+	if o.Flag&PostOnly != 0 {
+		p, ok := ob.postOnlyPrice(o.Side, o.Price)
+		if !ok {
+			ob.putOrder(MsgCreateOrder, Canceled, o, o.Qty, decimal.Zero, ReasonPostOnly, ErrPostOnly)
+			ob.release(o)
+			return
+		}
+		o.Price = p
+	}
+
+	ob.processOrder(o)
+}
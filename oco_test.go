@@ -0,0 +1,211 @@
+package orderbook
+
+import (
+	"bytes"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func addLinkedOrder(ob *OrderBook, id uint64, class ClassType, side SideType, qty, price, trigPrice uint64, flag FlagType, group, parent uint64) {
+	ob.AddOrderWithAttrs(tok, id, class, side, decimal.New(qty, 0), decimal.New(price, 0), decimal.New(trigPrice, 0), flag, OrderAttrs{
+		Group:  group,
+		Parent: parent,
+	})
+	tok++
+}
+
+func TestOCO_FillCancelsOther(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	10	95	0	N")
+	processLine(ob, "2	L	S	5	100	0	N")
+	processLine(ob, "3	M	B	1	0	0	N") // @ LP 100
+	n.Reset()
+
+	addLinkedOrder(ob, 10, Limit, Sell, 2, 110, 0, None, 7, 0)
+	addLinkedOrder(ob, 11, Market, Sell, 2, 0, 90, StopLoss, 7, 0)
+	processLine(ob, "4	M	B	6	0	0	N") // @ LP 110
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 11 2",
+		"CreateOrder Accepted 4 6",
+		"2 4 FilledComplete FilledPartial 4 100",
+		"10 4 FilledComplete FilledComplete 2 110",
+		"CancelOrder Canceled 11 2 ErrLinkedOrder",
+	})
+	assert.Nil(t, ob.Order(11))
+	assert.Equal(t, uint64(0), ob.triggerUnder.Len())
+	assert.True(t, ob.groups.Empty())
+}
+
+func TestOCO_TriggerCancelsOther(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	10	95	0	N")
+	processLine(ob, "2	L	S	5	100	0	N")
+	processLine(ob, "3	M	B	1	0	0	N") // @ LP 100
+	n.Reset()
+
+	addLinkedOrder(ob, 10, Limit, Sell, 2, 110, 0, None, 7, 0)
+	addLinkedOrder(ob, 11, Market, Sell, 2, 0, 95, StopLoss, 7, 0)
+	processLine(ob, "5	M	S	5	0	0	N") // @ LP 95
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 11 2",
+		"CreateOrder Accepted 5 5",
+		"1 5 FilledPartial FilledComplete 5 95",
+		"CreateOrder Triggered 11 2",
+		"CancelOrder Canceled 10 2 ErrLinkedOrder",
+		"1 11 FilledPartial FilledComplete 2 95",
+	})
+	assert.Nil(t, ob.Order(10))
+	assert.True(t, ob.groups.Empty())
+}
+
+func TestOCO_SameLevel(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	addLinkedOrder(ob, 10, Limit, Sell, 2, 110, 0, None, 7, 0)
+	addLinkedOrder(ob, 11, Limit, Sell, 2, 110, 0, None, 7, 0)
+	processLine(ob, "12	L	S	1	110	0	N")
+	processLine(ob, "1	L	B	4	110	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 11 2",
+		"CreateOrder Accepted 12 1",
+		"CreateOrder Accepted 1 4",
+		"10 1 FilledComplete FilledPartial 2 110",
+		"12 1 FilledComplete FilledPartial 1 110",
+		"CancelOrder Canceled 11 2 ErrLinkedOrder",
+	})
+	assert.Equal(t, decimal.New(1, 0), ob.Order(1).Qty)
+	assert.Equal(t, uint64(0), ob.asks.Len())
+}
+
+func TestOCO_CancelLeg(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	addLinkedOrder(ob, 10, Limit, Sell, 2, 110, 0, None, 7, 0)
+	addLinkedOrder(ob, 11, Limit, Sell, 2, 120, 0, None, 7, 0)
+	ob.CancelOrder(tok, 10)
+	tok++
+	ob.CancelOrder(tok, 11)
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 11 2",
+		"CancelOrder Canceled 10 2",
+		"CancelOrder Canceled 11 2",
+	})
+	assert.True(t, ob.groups.Empty())
+}
+
+func TestBracket(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	S	5	105	0	N")
+	processLine(ob, "10	L	B	2	100	0	N")
+	n.Reset()
+
+	addLinkedOrder(ob, 20, Limit, Sell, 2, 120, 0, None, 9, 10)
+	addLinkedOrder(ob, 21, Market, Sell, 2, 0, 90, StopLoss, 9, 10)
+	addLinkedOrder(ob, 22, Limit, Sell, 2, 120, 0, None, 9, 99)
+
+	require.NotNil(t, ob.Order(20))
+	assert.Equal(t, uint64(1), ob.asks.Len())
+	assert.Equal(t, uint64(0), ob.triggerUnder.Len())
+
+	processLine(ob, "2	M	S	1	0	0	N") // @ LP 100
+	assert.Equal(t, uint64(1), ob.asks.Len())
+
+	processLine(ob, "3	M	S	1	0	0	N") // entry filled
+	assert.Equal(t, uint64(2), ob.asks.Len())
+	assert.Equal(t, uint64(1), ob.triggerUnder.Len())
+
+	processLine(ob, "4	M	B	7	0	0	N") // @ LP 120
+	assert.Nil(t, ob.Order(21))
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 20 2",
+		"CreateOrder Accepted 21 2",
+		"CreateOrder Rejected 22 2 ErrOrderNotExists",
+		"CreateOrder Accepted 2 1",
+		"10 2 FilledPartial FilledComplete 1 100",
+		"CreateOrder Accepted 3 1",
+		"10 3 FilledComplete FilledComplete 1 100",
+		"CreateOrder Accepted 4 7",
+		"1 4 FilledComplete FilledPartial 5 105",
+		"20 4 FilledComplete FilledComplete 2 120",
+		"CancelOrder Canceled 21 2 ErrLinkedOrder",
+	})
+}
+
+func TestBracket_EntryCanceled(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "10	L	B	2	100	0	N")
+
+	addLinkedOrder(ob, 20, Limit, Sell, 2, 120, 0, None, 9, 10)
+	addLinkedOrder(ob, 21, Market, Sell, 2, 0, 90, StopLoss, 9, 10)
+	ob.CancelOrder(tok, 21)
+	tok++
+	ob.CancelOrder(tok, 10)
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 20 2",
+		"CreateOrder Accepted 21 2",
+		"CancelOrder Canceled 21 2",
+		"CancelOrder Canceled 10 2",
+		"CancelOrder Canceled 20 2 ErrLinkedOrder",
+	})
+	assert.Nil(t, ob.Order(20))
+	assert.True(t, ob.held.Empty())
+}
+
+func TestBracket_Snapshot(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	S	5	105	0	N")
+	processLine(ob, "10	L	B	2	100	0	N")
+	addLinkedOrder(ob, 20, Limit, Sell, 2, 120, 0, None, 9, 10)
+	addLinkedOrder(ob, 21, Market, Sell, 2, 0, 90, StopLoss, 9, 10)
+	addLinkedOrder(ob, 30, Limit, Buy, 1, 95, 0, None, 8, 0)
+	addLinkedOrder(ob, 31, Limit, Buy, 1, 80, 0, None, 8, 0)
+	n.Reset()
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(bytes.NewReader(buf.Bytes()), rn)
+	require.NoError(t, err)
+	require.NotNil(t, rob.Order(21))
+
+	next := []string{
+		"2	M	S	2	0	0	N",
+		"3	M	S	1	0	0	N",
+		"4	M	B	7	0	0	N",
+	}
+	for _, line := range next {
+		processLine(ob, line)
+		tok--
+		processLine(rob, line)
+	}
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 2 2",
+		"10 2 FilledComplete FilledComplete 2 100",
+		"CreateOrder Accepted 3 1",
+		"30 3 FilledComplete FilledComplete 1 95",
+		"CancelOrder Canceled 31 1 ErrLinkedOrder",
+		"CreateOrder Accepted 4 7",
+		"1 4 FilledComplete FilledPartial 5 105",
+		"20 4 FilledComplete FilledComplete 2 120",
+		"CancelOrder Canceled 21 2 ErrLinkedOrder",
+	})
+	assert.Equal(t, n.Strings(), rn.Strings())
+}
@@ -1,5 +1,11 @@
 package orderbook
 
+import (
+	"time"
+
+	decimal "github.com/geseq/udecimal"
+)
+
 type Option func(*OrderBook)
 
 type options []Option
@@ -24,22 +30,153 @@ func WithMatching(b bool) Option {
 	return func(o *OrderBook) { o.matching = b }
 }
 
-// WithOrderPoolSize sets the size of the order pool
+// WithAuction starts the book in the OpeningAuction session state. Orders are
+// collected without matching until Uncross is called.
+func WithAuction(b bool) Option {
+	return func(o *OrderBook) {
+		if b {
+			o.state = OpeningAuction
+		}
+	}
+}
+
+// WithStateHash maintains the hash returned by StateHash as orders are added,
+// removed and filled instead of computing it on demand. It makes StateHash
+// O(1) at a small cost on every change of the book.
+func WithStateHash(b bool) Option {
+	return func(o *OrderBook) { o.hashed = b }
+}
+
+// WithPostOnlySlide makes post-only orders that would cross the book rest one
+// tick away from the best opposite price instead of being rejected. The slide
+// price is rounded away from the opposite side to the tick size of the
+// instrument. A zero tick disables the slide.
+func WithPostOnlySlide(tick decimal.Decimal) Option {
+	return func(o *OrderBook) { o.postOnlySlide = tick }
+}
+
+// WithProRata makes the book allocate incoming orders among the orders resting
+// at each price as configured by p instead of in time priority
+func WithProRata(p ProRata) Option {
+	return func(o *OrderBook) { o.proRata = &p }
+}
+
+// WithSelfTradePrevention sets how matches between orders of the same owner
+// are resolved
+func WithSelfTradePrevention(mode STPMode) Option {
+	return func(o *OrderBook) { o.stpMode = mode }
+}
+
+// WithSessionClose sets the time of day, as an offset from midnight UTC, at
+// which DAY orders expire
+func WithSessionClose(offset time.Duration) Option {
+	return func(o *OrderBook) { o.sessionClose = int64(offset) % sessionLength }
+}
+
+// WithEventHandler delivers order and trade events to h instead of the
+// NotificationHandler passed to NewOrderBook
+func WithEventHandler(h EventHandler) Option {
+	return func(o *OrderBook) { o.events = h }
+}
+
+// WithStateHandler reports the session state changes of the book to h
+func WithStateHandler(h StateHandler) Option {
+	return func(o *OrderBook) { o.states = h }
+}
+
+// WithMarketDataHandler publishes the changes of the bids and asks to h
+func WithMarketDataHandler(h MarketDataHandler) Option {
+	return func(o *OrderBook) { o.md = &marketData{handler: h} }
+}
+
+// WithJournal appends every token consuming call of the book to j
+func WithJournal(j *Journal) Option {
+	return func(o *OrderBook) { o.journal = j }
+}
+
+// WithPools makes the book allocate orders, order queues and price tree nodes
+// from p instead of creating its own pools of the configured sizes. Books that
+// share pools must be driven from the same goroutine.
+func WithPools(p *Pools) Option {
+	return func(o *OrderBook) { o.pools = p }
+}
+
+// WithTickSize only accepts prices that are a multiple of tick
+func WithTickSize(tick decimal.Decimal) Option {
+	return WithTickTable(TickBand{Tick: tick})
+}
+
+// WithTickTable only accepts prices that are a multiple of the tick size of
+// the band they fall in
+func WithTickTable(bands ...TickBand) Option {
+	return func(o *OrderBook) { o.inst.setTicks(bands) }
+}
+
+// WithLotSize only accepts quantities, including the displayed quantity of
+// iceberg orders, that are a multiple of lot
+func WithLotSize(lot decimal.Decimal) Option {
+	return func(o *OrderBook) { o.inst.lot = lot }
+}
+
+// WithOrderQtyLimits only accepts order quantities from minQty to maxQty. A zero
+// maxQty sets no upper limit.
+func WithOrderQtyLimits(minQty, maxQty decimal.Decimal) Option {
+	return func(o *OrderBook) { o.inst.minQty, o.inst.maxQty = minQty, maxQty }
+}
+
+// WithMaxNotional rejects orders whose quantity times price exceeds notional
+func WithMaxNotional(notional decimal.Decimal) Option {
+	return func(o *OrderBook) { o.inst.maxNotional = notional }
+}
+
+// WithStaticBand stops incoming orders from matching at prices outside of band
+// around reference. The reference can be moved later with SetReferencePrice.
+func WithStaticBand(reference decimal.Decimal, band Band) Option {
+	return func(o *OrderBook) { o.collar.reference, o.collar.static = reference, band }
+}
+
+// WithDynamicBand stops incoming orders from matching at prices outside of band
+// around the last price before the order arrived
+func WithDynamicBand(band Band) Option {
+	return func(o *OrderBook) { o.collar.dynamic = band }
+}
+
+// WithCollarAction sets what happens to the remainder of an order that stopped
+// matching at the edge of a price band. The default is CollarCancel.
+func WithCollarAction(a CollarAction) Option {
+	return func(o *OrderBook) { o.collar.action = a }
+}
+
+// WithCircuitBreaker moves the book into a volatility auction when an order
+// stops matching at the edge of the dynamic band. The auction ends, and the
+// book is uncrossed, after tokens more tokens have been consumed and the clock
+// has advanced by d.
+func WithCircuitBreaker(tokens uint64, d time.Duration) Option {
+	return func(o *OrderBook) { o.collar.haltTokens, o.collar.haltTime = tokens, int64(d) }
+}
+
+// WithOrderPoolSize sets the number of released orders the book keeps for
+// reuse. The pools of the book are filled on demand; pass pools created by
+// NewPools to WithPools to preallocate them instead.
 func WithOrderPoolSize(size uint64) Option {
 	return func(o *OrderBook) { o.orderPoolSize = size }
 }
 
-// WithNodeTreePoolSize sets the size of the node tree pool
+// WithNodeTreePoolSize sets the number of released tree nodes the price
+// levels of the book keep for reuse. It has no effect if WithPools is used.
 func WithNodeTreePoolSize(size uint64) Option {
 	return func(o *OrderBook) { o.nodeTreePoolSize = size }
 }
 
-// WithOrderTreeNodePoolSize sets the size of the order tree node pool
+// WithOrderTreeNodePoolSize sets the number of released tree nodes kept for
+// reuse by each of the trees that index orders by expiry time, OCO group,
+// bracket entry and trailing stop
 func WithOrderTreeNodePoolSIze(size uint64) Option {
 	return func(o *OrderBook) { o.orderTreeNodePoolSize = size }
 }
 
-// WithOrderQueuePoolSize sets the size of the order queue pool
+// WithOrderQueuePoolSize sets the number of released order queues the book
+// keeps for reuse. It has no effect if WithPools is used.
 func WithOrderQueuePoolSize(size uint64) Option {
 	return func(o *OrderBook) { o.orderQueuePoolSize = size }
 }
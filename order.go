@@ -8,9 +8,16 @@ import (
 	decimal "github.com/geseq/udecimal"
 )
 
-// NewOrder creates new constant object Order
+// NewOrder creates new constant object Order. Orders placed through an
+// OrderBook are allocated from the pools of the book instead.
 func NewOrder(orderID uint64, class ClassType, side SideType, qty, price, trigPrice decimal.Decimal, flag FlagType) *Order {
-	o := oPool.Get()
+	o := new(Order).set(orderID, class, side, qty, price, trigPrice, flag)
+	o.OrderAttrs = new(OrderAttrs)
+	return o
+}
+
+// set initializes o as a new order
+func (o *Order) set(orderID uint64, class ClassType, side SideType, qty, price, trigPrice decimal.Decimal, flag FlagType) *Order {
 	if class == Market {
 		price = decimal.Zero
 	}
@@ -22,10 +29,24 @@ func NewOrder(orderID uint64, class ClassType, side SideType, qty, price, trigPr
 	o.Qty = qty
 	o.Price = price
 	o.TrigPrice = trigPrice
+	o.OrderAttrs = &noAttrs
 
 	return o
 }
 
+// setAttrs sets the optional attributes of o, taking storage for them from
+// the pools of o unless they are all zero
+func (o *Order) setAttrs(attrs OrderAttrs) {
+	if attrs == (OrderAttrs{}) {
+		o.OrderAttrs = &noAttrs
+		return
+	}
+
+	a := o.pools.getAttrs()
+	*a = attrs
+	o.OrderAttrs = a
+}
+
 // GetPrice returns the price of the Order
 func (o *Order) GetPrice(t PriceType) decimal.Decimal {
 	if t == TrigPrice {
@@ -34,7 +55,46 @@ func (o *Order) GetPrice(t PriceType) decimal.Decimal {
 	return o.Price
 }
 
+// Visible returns the quantity of the order that is displayed in the book. For
+// an iceberg order this is the current peak, otherwise it is the whole quantity.
+func (o *Order) Visible() decimal.Decimal {
+	if o.DisplayQty.IsZero() {
+		return o.Qty
+	}
+	return o.visibleQty
+}
+
+// FilledQty returns the cumulative quantity filled so far
+func (o *Order) FilledQty() decimal.Decimal {
+	return o.filledQty
+}
+
+// refresh replenishes the displayed peak of an iceberg order from its reserve
+func (o *Order) refresh() {
+	if o.DisplayQty.IsZero() {
+		return
+	}
+
+	if o.Qty.LessThan(o.DisplayQty) {
+		o.visibleQty = o.Qty
+	} else {
+		o.visibleQty = o.DisplayQty
+	}
+}
+
+// Release clears o and returns it to the pools it was allocated from. Orders
+// created with NewOrder are only cleared.
 func (o *Order) Release() {
+	p := o.pools
+	if o.OrderAttrs != &noAttrs {
+		p.putAttrs(o.OrderAttrs)
+	}
+	o.reset()
+	p.putOrder(o)
+}
+
+// reset clears o before it is returned to its pool
+func (o *Order) reset() {
 	o.next = nil
 	o.prev = nil
 	o.queue = nil
@@ -45,8 +105,11 @@ func (o *Order) Release() {
 	o.Qty = decimal.Zero
 	o.Price = decimal.Zero
 	o.TrigPrice = decimal.Zero
-
-	oPool.Put(o)
+	o.OrderAttrs = nil
+	o.visibleQty = decimal.Zero
+	o.filledQty = decimal.Zero
+	o.canceled = false
+	o.pools = nil
 }
 
 // Compose converts the order to a binary representation
@@ -57,6 +120,18 @@ func (o *Order) Compose() []byte {
 	n := binary.PutUvarint(idbuf, o.ID)
 	buf.Write(idbuf[:n])
 
+	n = binary.PutUvarint(idbuf, o.Owner)
+	buf.Write(idbuf[:n])
+
+	n = binary.PutVarint(idbuf, o.ExpireAt)
+	buf.Write(idbuf[:n])
+
+	n = binary.PutUvarint(idbuf, o.Group)
+	buf.Write(idbuf[:n])
+
+	n = binary.PutUvarint(idbuf, o.Parent)
+	buf.Write(idbuf[:n])
+
 	b, _ := o.Qty.MarshalBinary()
 	buf.Write(b)
 
@@ -66,9 +141,23 @@ func (o *Order) Compose() []byte {
 	b, _ = o.TrigPrice.MarshalBinary()
 	buf.Write(b)
 
+	b, _ = o.DisplayQty.MarshalBinary()
+	buf.Write(b)
+
+	b, _ = o.visibleQty.MarshalBinary()
+	buf.Write(b)
+
+	b, _ = o.TrailOffset.MarshalBinary()
+	buf.Write(b)
+
+	b, _ = o.filledQty.MarshalBinary()
+	buf.Write(b)
+
 	buf.WriteByte(byte(o.Class))
 	buf.WriteByte(byte(o.Side))
 	buf.WriteByte(byte(o.Flag))
+	buf.WriteByte(byte(o.TIF))
+	buf.WriteByte(byte(o.TrailType))
 
 	return buf.Bytes()
 }
@@ -77,27 +166,56 @@ func (o *Order) Compose() []byte {
 func (o *Order) Decompose(b []byte) error {
 	id, n := binary.Uvarint(b)
 	b = b[n:]
+	owner, n := binary.Uvarint(b)
+	b = b[n:]
+	expireAt, n := binary.Varint(b)
+	b = b[n:]
+	group, n := binary.Uvarint(b)
+	b = b[n:]
+	parent, n := binary.Uvarint(b)
+	b = b[n:]
 	qty := decimal.Decimal{}
 	b, _ = qty.UnmarshalBinaryData(b)
 	price := decimal.Decimal{}
 	b, _ = price.UnmarshalBinaryData(b)
 	trigPrice := decimal.Decimal{}
 	b, _ = trigPrice.UnmarshalBinaryData(b)
-
-	if len(b) != 3 {
+	displayQty := decimal.Decimal{}
+	b, _ = displayQty.UnmarshalBinaryData(b)
+	visibleQty := decimal.Decimal{}
+	b, _ = visibleQty.UnmarshalBinaryData(b)
+	trailOffset := decimal.Decimal{}
+	b, _ = trailOffset.UnmarshalBinaryData(b)
+	filledQty := decimal.Decimal{}
+	b, _ = filledQty.UnmarshalBinaryData(b)
+
+	if len(b) != 5 {
 		return errors.New("decompose failed: invalid bytes provided")
 	}
 
 	ord := Order{
-		ID:        id,
-		Class:     ClassType(b[0]),
-		Side:      SideType(b[1]),
-		Qty:       qty,
-		Price:     price,
-		TrigPrice: trigPrice,
-		Flag:      FlagType(b[2]),
+		ID:         id,
+		Class:      ClassType(b[0]),
+		Side:       SideType(b[1]),
+		Qty:        qty,
+		Price:      price,
+		TrigPrice:  trigPrice,
+		Flag:       FlagType(b[2]),
+		visibleQty: visibleQty,
+		filledQty:  filledQty,
+		pools:      o.pools,
 	}
 	*o = ord
+	o.setAttrs(OrderAttrs{
+		DisplayQty:  displayQty,
+		Owner:       owner,
+		TIF:         TimeInForce(b[3]),
+		ExpireAt:    expireAt,
+		TrailType:   TrailType(b[4]),
+		TrailOffset: trailOffset,
+		Group:       group,
+		Parent:      parent,
+	})
 
 	return nil
 }
@@ -20,7 +20,13 @@ func TestOrderCompose(t *testing.T) {
 		NewOrder(4123412, Limit, Buy, decimal.New(22, -1), decimal.New(22, 1), decimal.Zero, AoN),
 		NewOrder(830459304501, Limit, Sell, decimal.New(33, -1), decimal.New(33, 1), decimal.Zero, FoK),
 		NewOrder(237823742802, Limit, Sell, decimal.New(44, -1), decimal.New(44, 1), decimal.Zero, IoC),
+		NewOrder(237823742803, Limit, Sell, decimal.New(55, -1), decimal.New(55, 1), decimal.Zero, None),
+		NewOrder(237823742804, Market, Sell, decimal.New(66, -1), decimal.Zero, decimal.New(66, 1), StopLoss),
 	}
+	data[5].DisplayQty = decimal.New(1, 0)
+	data[5].refresh()
+	data[6].TrailType = TrailPercent
+	data[6].TrailOffset = decimal.New(5, -2)
 
 	var result = [][]byte{}
 	for _, order := range data {
@@ -49,5 +55,6 @@ func TestOrderCompose(t *testing.T) {
 		assert.NoError(t, err)
 
 		assert.Equal(t, db, rdb)
+		assert.Equal(t, data[i].Visible(), resultDec[i].Visible())
 	}
 }
@@ -3,7 +3,7 @@ package orderbook
 import (
 	"sync/atomic"
 
-	"github.com/geseq/orderbook/pkg/pool"
+	local_tree "github.com/geseq/orderbook/pkg/tree"
 	decimal "github.com/geseq/udecimal"
 )
 
@@ -13,25 +13,53 @@ type NotificationHandler interface {
 	PutTrade(makerOrderID, takerOrderID uint64, makerStatus, takerStatus OrderStatus, qty, price decimal.Decimal)
 }
 
-var oPool = pool.NewItemPoolV2[Order](1)
-var oqPool = pool.NewItemPoolV2[orderQueue](1)
-
 // OrderBook implements standard matching algorithm
 type OrderBook struct {
 	asks         *priceLevel
 	bids         *priceLevel
-	triggerUnder *priceLevel                      // orders triggering under last price i.e. Stop Sell or Take Buy
-	triggerOver  *priceLevel                      // orders that trigger over last price i.e. Stop Buy or Take Sell
+	triggerUnder *priceLevel // orders triggering under last price i.e. Stop Sell or Take Buy
+	triggerOver  *priceLevel // orders that trigger over last price i.e. Stop Buy or Take Sell
 	orders       *orderIndex // orderId -> *Order
 	trigOrders   *orderIndex // orderId -> *Order
 	trigQueue    *triggerQueue
-
-	notification NotificationHandler
+	trailing     []*Order                           // scratch space for repositioning trailing stops
+	expiries     *local_tree.Tree[int64, []uint64]  // expiry time -> order ids
+	groups       *local_tree.Tree[uint64, []uint64] // OCO group -> leg order ids
+	held         *local_tree.Tree[uint64, []*Order] // bracket entry id -> held exits
+	heldOrders   *orderIndex                        // orderId -> held *Order
+	linked       []*Order                           // legs of fired OCO groups
+	allocs       []allocation                       // scratch space for pro-rata allocation
+	activated    []*Order                           // exits of filled bracket entries
+
+	events  EventHandler
+	states  StateHandler
+	md      *marketData
+	journal *Journal
+
+	orderEvent OrderEvent // reused for every event to avoid allocations
+	tradeEvent TradeEvent
+	stateEvent StateEvent
+	tradeID    uint64
 
 	lastPrice decimal.Decimal
 	lastToken uint64
 
-	matching bool
+	now          int64 // sequencer time of the last AdvanceTime call
+	sessionClose int64 // offset of the session close from midnight UTC
+
+	matching   bool
+	marketBids orderQueue // market orders resting during an auction
+	marketAsks orderQueue
+	state      SessionState
+
+	hashed        bool // see WithStateHash
+	postOnlySlide decimal.Decimal
+	stpMode       STPMode
+	proRata       *ProRata // nil matches in price-time priority
+	inst          instrument
+	collar        collar
+
+	pools *Pools
 
 	orderPoolSize         uint64
 	nodeTreePoolSize      uint64
@@ -53,22 +81,37 @@ func Uint64Cmp(a, b uint64) int {
 // NewOrderBook creates Orderbook object
 func NewOrderBook(n NotificationHandler, opts ...Option) *OrderBook {
 	ob := &OrderBook{
-		trigQueue:    newTriggerQueue(),
-		bids:         newPriceLevel(BidPrice),
-		asks:         newPriceLevel(AskPrice),
-		triggerUnder: newPriceLevel(TrigPrice),
-		triggerOver:  newPriceLevel(TrigPrice),
-		notification: n,
+		trigQueue: newTriggerQueue(),
+		events:    NewNotificationAdapter(n),
 	}
 
 	options(defaultOpts).applyTo(ob)
 	options(opts).applyTo(ob)
 
+	if ob.pools == nil {
+		// Pools of the book's own are filled as orders are released
+		ob.pools = newLazyPools(ob.orderPoolSize, ob.orderQueuePoolSize, ob.nodeTreePoolSize)
+	}
+
+	ob.bids = newPriceLevel(BidPrice, ob.pools)
+	ob.asks = newPriceLevel(AskPrice, ob.pools)
+	ob.triggerUnder = newPriceLevel(TrigPrice, ob.pools)
+	ob.triggerOver = newPriceLevel(TrigPrice, ob.pools)
+	for _, pl := range ob.snapshotLevels() {
+		pl.hashed = ob.hashed
+	}
+	ob.bids.md = ob.md
+	ob.asks.md = ob.md
+
+	ob.expiries = newExpiryTree(ob.orderTreeNodePoolSize)
+	ob.groups = newGroupTree(ob.orderTreeNodePoolSize)
+	ob.held = newHeldTree(ob.orderTreeNodePoolSize)
+	ob.triggerUnder.trailing = newTrailingTree(ob.orderTreeNodePoolSize)
+	ob.triggerOver.trailing = newTrailingTree(ob.orderTreeNodePoolSize)
+
 	ob.orders = newOrderIndex(ob.orderPoolSize)
 	ob.trigOrders = newOrderIndex(2)
-
-	oPool = pool.NewItemPoolV2[Order](ob.orderPoolSize)
-	oqPool = pool.NewItemPoolV2[orderQueue](ob.orderQueuePoolSize)
+	ob.heldOrders = newOrderIndex(2)
 
 	return ob
 }
@@ -86,185 +129,499 @@ func NewOrderBook(n NotificationHandler, opts ...Option) *OrderBook {
 //	* to create new decimal number you should use udecimal.New() func
 //	  read more at https://github.com/geseq/udecimal
 func (ob *OrderBook) AddOrder(tok, id uint64, class ClassType, side SideType, quantity, price, trigPrice decimal.Decimal, flag FlagType) {
+	ob.AddOrderWithAttrs(tok, id, class, side, quantity, price, trigPrice, flag, OrderAttrs{})
+}
+
+// AddOrderWithAttrs places new order with optional attributes to the OrderBook.
+// The arguments are the same as AddOrder; attrs carries the attributes that
+// only some orders need, such as the display quantity of an iceberg order.
+func (ob *OrderBook) AddOrderWithAttrs(tok, id uint64, class ClassType, side SideType, quantity, price, trigPrice decimal.Decimal, flag FlagType, attrs OrderAttrs) {
 	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
 		panic("invalid token received: cannot maintain determinism")
 	}
+	if ob.journal != nil {
+		ob.journal.addOrder(tok, id, class, side, quantity, price, trigPrice, flag, attrs)
+	}
+	ob.checkBreaker(tok)
 
-	if quantity.Equal(decimal.Zero) {
-		ob.notification.PutOrder(MsgCreateOrder, Rejected, id, quantity, ErrInvalidQuantity)
+	if err := ob.validateOrder(class, flag, quantity, price, trigPrice, attrs.DisplayQty); err != nil {
+		ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, err)
 		return
 	}
 
-	if !ob.matching {
-		// If matching is disabled reject all orders that cross the book
-		if class == Market {
-			ob.notification.PutOrder(MsgCreateOrder, Rejected, id, quantity, ErrNoMatching)
+	// Any order may come to rest, if only in an auction or at a band edge,
+	// so its id must not be taken
+	if ob.exists(id) {
+		ob.putReject(MsgCreateOrder, id, side, price, decimal.Zero, ReasonNone, ErrOrderExists)
+		return
+	}
+
+	switch attrs.TIF {
+	case GTD:
+		if attrs.ExpireAt <= ob.now {
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrOrderExpired)
 			return
 		}
+	case DAY:
+		attrs.ExpireAt = ob.nextSessionClose()
+	}
 
-		if side == Buy {
-			q := ob.asks.GetQueue()
-			if q != nil && q.Price().LessThanOrEqual(price) {
-				ob.notification.PutOrder(MsgCreateOrder, Rejected, id, quantity, ErrNoMatching)
+	if attrs.Parent != 0 {
+		if _, ok := ob.orders.get(attrs.Parent); !ok {
+			if _, ok := ob.trigOrders.get(attrs.Parent); !ok {
+				ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrOrderNotExists)
 				return
 			}
-		} else {
-			q := ob.bids.GetQueue()
-			if q != nil && q.Price().GreaterThanOrEqual(price) {
-				ob.notification.PutOrder(MsgCreateOrder, Rejected, id, quantity, ErrNoMatching)
+		}
+	}
+
+	if !ob.state.accepts(class, flag) {
+		ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrSessionState)
+		return
+	}
 
+	if !ob.state.collects() && !ob.matching {
+		// If matching is disabled reject all orders that cross the book
+		if class == Market || ob.crosses(side, price) {
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrNoMatching)
+			return
+		}
+	}
+
+	if flag&PostOnly != 0 {
+		if class == Market {
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrPostOnly)
+			return
+		}
+
+		if flag&(StopLoss|TakeProfit) == 0 && !ob.state.collects() {
+			p, ok := ob.postOnlyPrice(side, price)
+			if !ok {
+				ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrPostOnly)
 				return
 			}
+			price = p
+		}
+	}
+
+	if attrs.TrailType != TrailNone {
+		if flag&StopLoss == 0 || attrs.TrailOffset.IsZero() {
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrInvalidTrail)
+			return
+		}
+
+		if trigPrice.IsZero() && !ob.lastPrice.IsZero() {
+			// Start trailing from the last price
+			trigPrice, _ = ob.trailPrice(side, ob.lastPrice, &attrs)
 		}
 	}
 
 	if flag&(StopLoss|TakeProfit) != 0 {
 		if trigPrice.IsZero() {
-			ob.notification.PutOrder(MsgCreateOrder, Rejected, id, quantity, ErrInvalidTriggerPrice)
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonNone, ErrInvalidTriggerPrice)
+			return
+		}
+
+		o := ob.pools.getOrder().set(id, class, side, quantity, price, trigPrice, flag)
+		o.setAttrs(attrs)
+		ob.putOrder(MsgCreateOrder, Accepted, o, quantity, quantity, ReasonNone, nil)
+		if o.Parent != 0 {
+			ob.hold(o)
 			return
 		}
 
-		ob.notification.PutOrder(MsgCreateOrder, Accepted, id, quantity, nil)
-		ob.addTrigOrder(id, class, side, quantity, price, trigPrice, flag)
+		ob.joinGroup(o)
+		ob.addTrigOrder(o)
 		return
 	}
 
-	if class != Market {
-		if _, ok := ob.orders.get(id); ok {
-			ob.notification.PutOrder(MsgCreateOrder, Rejected, id, decimal.Zero, ErrOrderExists)
-			return
-		}
+	if class != Market && price.Equal(decimal.Zero) {
+		ob.putReject(MsgCreateOrder, id, side, price, decimal.Zero, ReasonNone, ErrInvalidPrice)
+		return
+	}
+
+	if attrs.Parent != 0 {
+		o := ob.pools.getOrder().set(id, class, side, quantity, price, decimal.Zero, flag)
+		o.setAttrs(attrs)
+		ob.putOrder(MsgCreateOrder, Accepted, o, quantity, quantity, ReasonNone, nil)
+		ob.hold(o)
+		return
+	}
 
-		if price.Equal(decimal.Zero) {
-			ob.notification.PutOrder(MsgCreateOrder, Rejected, id, decimal.Zero, ErrInvalidPrice)
+	if flag&FoK != 0 || (class == Market && flag&AoN != 0) {
+		// FoK orders and AoN market orders can never rest, so reject them
+		// up front unless they can be filled entirely right now
+		if !ob.canFill(side, class, price, quantity, attrs.Owner) {
+			ob.putReject(MsgCreateOrder, id, side, price, quantity, ReasonFoK, ErrNotFillable)
 			return
 		}
 	}
 
-	ob.notification.PutOrder(MsgCreateOrder, Accepted, id, quantity, nil)
-	ob.processOrder(id, class, side, quantity, price, flag)
+	o := ob.pools.getOrder().set(id, class, side, quantity, price, decimal.Zero, flag)
+	o.setAttrs(attrs)
+	ob.putOrder(MsgCreateOrder, Accepted, o, quantity, quantity, ReasonNone, nil)
+	ob.joinGroup(o)
+	ob.processOrder(o)
 
 	return
 }
 
-func (ob *OrderBook) addTrigOrder(id uint64, class ClassType, side SideType, quantity, price, stPrice decimal.Decimal, flag FlagType) {
-	switch flag {
-	case StopLoss:
-		switch side {
+// exists returns true if id is taken by an order resting, waiting to trigger
+// or held in the book
+func (ob *OrderBook) exists(id uint64) bool {
+	if _, ok := ob.orders.get(id); ok {
+		return true
+	}
+	if _, ok := ob.trigOrders.get(id); ok {
+		return true
+	}
+	_, ok := ob.heldOrders.get(id)
+	return ok
+}
+
+// crosses returns true if a limit order at the given price would match
+// against the best order on the opposite side of the book
+func (ob *OrderBook) crosses(side SideType, price decimal.Decimal) bool {
+	if side == Buy {
+		q := ob.asks.GetQueue()
+		return q != nil && q.Price().LessThanOrEqual(price)
+	}
+
+	q := ob.bids.GetQueue()
+	return q != nil && q.Price().GreaterThanOrEqual(price)
+}
+
+// canFill returns true if an order of owner can be filled entirely against the
+// opposite side of the book, respecting its limit price
+func (ob *OrderBook) canFill(side SideType, class ClassType, price, quantity decimal.Decimal, owner uint64) bool {
+	contra, compare := ob.asks, price.GreaterThanOrEqual
+	if side == Sell {
+		contra, compare = ob.bids, price.LessThanOrEqual
+	}
+
+	if class == Market {
+		compare = anyPrice
+	}
+
+	return contra.canFill(compare, quantity, ob.selfTrade(owner))
+}
+
+// postOnlyPrice returns the price at which a post-only order can rest without
+// taking liquidity. An order that would cross the book is rejected unless
+// post-only slide is enabled, in which case it is repriced one tick away from
+// the best opposite price.
+func (ob *OrderBook) postOnlyPrice(side SideType, price decimal.Decimal) (decimal.Decimal, bool) {
+	if !ob.crosses(side, price) {
+		return price, true
+	}
+
+	if ob.postOnlySlide.IsZero() {
+		return price, false
+	}
+
+	if side == Buy {
+		best := ob.asks.GetQueue().Price()
+		if best.LessThanOrEqual(ob.postOnlySlide) {
+			return price, false
+		}
+		p := ob.inst.floor(best.Sub(ob.postOnlySlide))
+		return p, !p.IsZero()
+	}
+
+	return ob.inst.ceil(ob.bids.GetQueue().Price().Add(ob.postOnlySlide)), true
+}
+
+func (ob *OrderBook) addTrigOrder(o *Order) {
+	ob.trackExpiry(o)
+
+	switch {
+	case o.Flag&StopLoss != 0:
+		switch o.Side {
 		case Buy:
-			if stPrice.LessThanOrEqual(ob.lastPrice) {
+			if o.TrigPrice.LessThanOrEqual(ob.lastPrice) {
 				// Stop buy set under stop price, condition satisfied to trigger
-				ob.processOrder(id, class, side, quantity, price, flag)
+				ob.trigger(o)
+				ob.processOrder(o)
 				return
 			}
 
-			ob.trigOrders.put(id, ob.triggerOver.Append(NewOrder(id, class, side, quantity, price, stPrice, flag)))
+			ob.trigOrders.put(o.ID, ob.triggerOver.Append(o))
 		case Sell:
-			if ob.lastPrice.LessThanOrEqual(stPrice) {
+			if ob.lastPrice.LessThanOrEqual(o.TrigPrice) {
 				// Stop sell set over stop price, condition satisfied to trigger
-				ob.processOrder(id, class, side, quantity, price, flag)
+				ob.trigger(o)
+				ob.processOrder(o)
 				return
 			}
 
-			ob.trigOrders.put(id, ob.triggerUnder.Append(NewOrder(id, class, side, quantity, price, stPrice, flag)))
+			ob.trigOrders.put(o.ID, ob.triggerUnder.Append(o))
 		}
-	case TakeProfit:
-		switch side {
+	case o.Flag&TakeProfit != 0:
+		switch o.Side {
 		case Buy:
-			if ob.lastPrice.LessThanOrEqual(stPrice) {
+			if ob.lastPrice.LessThanOrEqual(o.TrigPrice) {
 				// Stop buy set under stop price, condition satisfied to trigger
-				ob.processOrder(id, class, side, quantity, price, flag)
+				ob.trigger(o)
+				ob.processOrder(o)
 				return
 			}
 
-			ob.trigOrders.put(id, ob.triggerUnder.Append(NewOrder(id, class, side, quantity, price, stPrice, flag)))
+			ob.trigOrders.put(o.ID, ob.triggerUnder.Append(o))
 		case Sell:
-			if stPrice.LessThanOrEqual(ob.lastPrice) {
+			if o.TrigPrice.LessThanOrEqual(ob.lastPrice) {
 				// Stop sell set over stop price, condition satisfied to trigger
-				ob.processOrder(id, class, side, quantity, price, flag)
+				ob.trigger(o)
+				ob.processOrder(o)
 				return
 			}
 
-			ob.trigOrders.put(id, ob.triggerOver.Append(NewOrder(id, class, side, quantity, price, stPrice, flag)))
+			ob.trigOrders.put(o.ID, ob.triggerOver.Append(o))
 		}
 	}
 }
 
 func (ob *OrderBook) postProcess(lp decimal.Decimal) {
+	ob.processLinked()
 	if lp == ob.lastPrice {
 		return
 	}
 	ob.queueTriggeredOrders()
+	ob.processLinked()
 	ob.processTriggeredOrders()
 }
 
-func (ob *OrderBook) processOrder(id uint64, class ClassType, side SideType, quantity, price decimal.Decimal, flag FlagType) {
+// trigger reports the activation of a stop or take profit order and cancels
+// the other legs of its OCO group
+func (ob *OrderBook) trigger(o *Order) {
+	ob.putOrder(MsgCreateOrder, Triggered, o, o.Qty, o.Qty, ReasonNone, nil)
+	ob.fireGroup(o)
+}
+
+// cancelRemainder reports the unfilled quantity of a taker order that cannot
+// rest in the book
+func (ob *OrderBook) cancelRemainder(o *Order, qty decimal.Decimal) {
+	reason := ReasonIoC
+	if o.Flag&(FoK|AoN) != 0 {
+		reason = ReasonFoK
+	}
+	ob.putOrder(MsgCreateOrder, Canceled, o, qty, decimal.Zero, reason, nil)
+}
+
+// processOrder matches the taker order o against the book and rests any
+// remaining quantity. The book takes ownership of o, which is either appended
+// to the book or released back to the pool.
+func (ob *OrderBook) processOrder(o *Order) {
+	if ob.state.collects() {
+		ob.restAuction(o)
+		return
+	}
+
 	lp := ob.lastPrice
+	traded := o.filledQty
 
-	if class == Market {
-		if side == Buy {
-			ob.asks.processMarketOrder(ob, id, quantity, flag)
-		} else {
-			ob.bids.processMarketOrder(ob, id, quantity, flag)
+	edge, band := ob.collarEdge(o.Side, lp)
+	ob.cancelOutOfBand(o, lp)
+	if band != bandNone && o.Class == Limit && !o.beyond(edge) {
+		// The limit price of the order is within the band
+		band = bandNone
+	}
+
+	if o.Class == Market {
+		var qtyProcessed decimal.Decimal
+		switch {
+		case band != bandNone:
+			qtyProcessed = ob.matchUpTo(o, edge)
+		case o.Side == Buy:
+			qtyProcessed = ob.asks.processMarketOrder(ob, o)
+		default:
+			qtyProcessed = ob.bids.processMarketOrder(ob, o)
 		}
 
+		quantityLeft := o.Qty.Sub(qtyProcessed)
+		switch {
+		case quantityLeft.IsZero():
+			if o.filledQty.Sub(traded).Equal(o.Qty) {
+				ob.filled(o)
+			}
+			ob.release(o)
+		case band != bandNone && ob.collared(o, edge):
+			ob.collarRemainder(o, quantityLeft, edge, band)
+		default:
+			ob.cancelRemainder(o, quantityLeft)
+			ob.release(o)
+		}
 		ob.postProcess(lp)
 		return
 	}
 
-	var qtyProcessed decimal.Decimal
-	if side == Buy {
-		qtyProcessed = ob.asks.processLimitOrder(ob, price.GreaterThanOrEqual, id, quantity, flag)
-	} else {
-		qtyProcessed = ob.bids.processLimitOrder(ob, price.LessThanOrEqual, id, quantity, flag)
+	limit := o.Price
+	if band != bandNone {
+		limit = edge
+	}
+
+	quantityLeft := o.Qty.Sub(ob.matchUpTo(o, limit))
+	if quantityLeft.IsZero() && o.filledQty.Sub(traded).Equal(o.Qty) {
+		// Quantity canceled by self-trade prevention was not traded
+		ob.filled(o)
 	}
 
-	if flag == IoC || flag == FoK {
+	if o.canceled {
+		// A leg of the taker's own OCO group filled while it was matching
+		if quantityLeft.IsZero() {
+			ob.release(o)
+		} else {
+			o.Qty = quantityLeft
+			ob.cancelLinked(o)
+		}
 		ob.postProcess(lp)
 		return
 	}
 
-	quantityLeft := quantity.Sub(qtyProcessed)
-	if quantityLeft.GreaterThan(decimal.Zero) {
-		o := NewOrder(id, class, side, quantityLeft, price, decimal.Zero, flag)
-		if side == Buy {
-			ob.orders.put(id, ob.bids.Append(o))
-		} else {
-			ob.orders.put(id, ob.asks.Append(o))
+	if band != bandNone && !quantityLeft.IsZero() {
+		// The remainder of an order priced beyond the band never rests
+		// outside of it
+		ob.collarRemainder(o, quantityLeft, edge, band)
+		ob.postProcess(lp)
+		return
+	}
+
+	if o.Flag == IoC || o.Flag == FoK {
+		if quantityLeft.GreaterThan(decimal.Zero) {
+			ob.cancelRemainder(o, quantityLeft)
 		}
+		ob.release(o)
+		ob.postProcess(lp)
+		return
+	}
+
+	if quantityLeft.GreaterThan(decimal.Zero) {
+		o.Qty = quantityLeft
+		ob.rest(o)
+	} else {
+		ob.release(o)
 	}
 
 	ob.postProcess(lp)
 	return
 }
 
+// matchUpTo matches o against the opposite side of the book at prices up to
+// and including price
+func (ob *OrderBook) matchUpTo(o *Order, price decimal.Decimal) decimal.Decimal {
+	if o.Side == Buy {
+		return ob.asks.processLimitOrder(ob, price.GreaterThanOrEqual, o)
+	}
+	return ob.bids.processLimitOrder(ob, price.LessThanOrEqual, o)
+}
+
+// rest appends o to its side of the book
+func (ob *OrderBook) rest(o *Order) {
+	o.refresh()
+	if o.Side == Buy {
+		ob.orders.put(o.ID, ob.bids.Append(o))
+	} else {
+		ob.orders.put(o.ID, ob.asks.Append(o))
+	}
+	ob.trackExpiry(o)
+	ob.matchRestingAoN(o.Side)
+}
+
+// matchRestingAoN executes resting AoN orders opposite to side that can be
+// filled entirely now that liquidity was added on side
+func (ob *OrderBook) matchRestingAoN(side SideType) {
+	book, contra := ob.bids, ob.asks
+	if side == Sell {
+		book, contra = ob.asks, ob.bids
+	}
+
+	for contra.numAoN > 0 {
+		o := ob.fillableAoN(book, contra)
+		if o == nil {
+			return
+		}
+
+		ob.cancelOrder(o.ID)
+		ob.processOrder(o)
+	}
+}
+
+// fillableAoN returns the first resting AoN order in contra, in price-time
+// priority, that can be filled entirely against book
+func (ob *OrderBook) fillableAoN(book, contra *priceLevel) *Order {
+	best := book.GetQueue()
+	if best == nil {
+		return nil
+	}
+
+	for q := contra.GetQueue(); q != nil; q = contra.GetNextQueue(q.Price()) {
+		compare := q.Price().GreaterThanOrEqual
+		if contra.priceType == AskPrice {
+			compare = q.Price().LessThanOrEqual
+		}
+
+		if !compare(best.Price()) {
+			return nil
+		}
+
+		for o := q.Head(); o != nil; o = o.next {
+			if o.Flag&AoN != 0 && book.fillable(compare, o.Qty, ob.selfTrade(o.Owner)).Equal(o.Qty) {
+				return o
+			}
+		}
+	}
+
+	return nil
+}
+
 func (ob *OrderBook) queueTriggeredOrders() {
 	if ob.lastPrice.IsZero() {
 		return
 	}
 
+	ob.adjustTrailingStops()
+
 	lastPrice := ob.lastPrice
 
-	for q := ob.triggerOver.MaxPriceQueue(); q != nil && lastPrice.LessThanOrEqual(q.price); q = ob.triggerOver.MaxPriceQueue() {
+	for q := ob.triggerOver.MinPriceQueue(); q != nil && q.price.LessThanOrEqual(lastPrice); q = ob.triggerOver.MinPriceQueue() {
 		for q.Len() > 0 {
 			o := q.Head()
+			ob.trigOrders.remove(o.ID)
 			ob.triggerOver.Remove(o)
 			ob.trigQueue.Push(o)
+			ob.trigger(o)
 		}
 	}
 
-	for q := ob.triggerUnder.MinPriceQueue(); q != nil && lastPrice.GreaterThanOrEqual(q.price); q = ob.triggerUnder.MinPriceQueue() {
+	for q := ob.triggerUnder.MaxPriceQueue(); q != nil && q.price.GreaterThanOrEqual(lastPrice); q = ob.triggerUnder.MaxPriceQueue() {
 		for q.Len() > 0 {
 			o := q.Head()
+			ob.trigOrders.remove(o.ID)
 			ob.triggerUnder.Remove(o)
 			ob.trigQueue.Push(o)
+			ob.trigger(o)
 		}
 	}
 }
 
 func (ob *OrderBook) processTriggeredOrders() {
 	for o := ob.trigQueue.Pop(); o != nil; o = ob.trigQueue.Pop() {
-		ob.processOrder(o.ID, o.Class, o.Side, o.Qty, o.Price, o.Flag)
+		if o.canceled {
+			// Another leg of the OCO group triggered first
+			ob.cancelLinked(o)
+			continue
+		}
+
+		if o.Flag&PostOnly != 0 {
+			p, ok := ob.postOnlyPrice(o.Side, o.Price)
+			if !ok {
+				ob.putOrder(MsgCreateOrder, Canceled, o, o.Qty, decimal.Zero, ReasonPostOnly, ErrPostOnly)
+				ob.release(o)
+				continue
+			}
+			o.Price = p
+		}
+
+		ob.processOrder(o)
 	}
 }
 
@@ -274,7 +631,7 @@ func (ob *OrderBook) Order(orderID uint64) *Order {
 	if !ok {
 		o, ok := ob.trigOrders.get(orderID)
 		if !ok {
-			return nil
+			o, _ = ob.heldOrders.get(orderID)
 		}
 
 		return o
@@ -288,31 +645,154 @@ func (ob *OrderBook) CancelOrder(tok, orderID uint64) {
 	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
 		panic("invalid token received: cannot maintain determinism")
 	}
+	if ob.journal != nil {
+		ob.journal.cancelOrder(tok, orderID)
+	}
+	ob.checkBreaker(tok)
 
 	o := ob.cancelOrder(orderID)
 	if o == nil {
-		ob.notification.PutOrder(MsgCancelOrder, Rejected, orderID, decimal.Zero, ErrOrderNotExists)
+		ob.putReject(MsgCancelOrder, orderID, 0, decimal.Zero, decimal.Zero, ReasonNone, ErrOrderNotExists)
 		return
 	}
 
-	ob.notification.PutOrder(MsgCancelOrder, Canceled, o.ID, o.Qty, nil)
-	o.Release()
+	ob.putOrder(MsgCancelOrder, Canceled, o, o.Qty, decimal.Zero, ReasonUser, nil)
+	ob.release(o)
+}
+
+// validateOrder checks the quantities and prices of a new or modified order
+func (ob *OrderBook) validateOrder(class ClassType, flag FlagType, qty, price, trigPrice, displayQty decimal.Decimal) error {
+	if qty.Equal(decimal.Zero) {
+		return ErrInvalidQuantity
+	}
+
+	// An AoN order trades its whole quantity at once, so it has no peak
+	if displayQty.GreaterThan(qty) || (flag&AoN != 0 && !displayQty.IsZero()) {
+		return ErrInvalidDisplayQty
+	}
+
+	if err := ob.inst.validate(class, qty, price, trigPrice); err != nil {
+		return err
+	}
+
+	if !ob.inst.multipleOf(displayQty, ob.inst.lot) {
+		return ErrLotSize
+	}
+
+	return nil
+}
+
+// ModifyOrder amends the quantity and price of a resting limit order in place
+// so that the order keeps its ID.
+//
+// Reducing the quantity at an unchanged price keeps the order's position in
+// its queue. A price change or a quantity increase moves the order to the tail
+// of the queue at its new price; if the new price crosses the book the order
+// is matched first, exactly as a new order would be.
+func (ob *OrderBook) ModifyOrder(tok, id uint64, newQty, newPrice decimal.Decimal) {
+	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
+		panic("invalid token received: cannot maintain determinism")
+	}
+	if ob.journal != nil {
+		ob.journal.modifyOrder(tok, id, newQty, newPrice)
+	}
+	ob.checkBreaker(tok)
+
+	o, ok := ob.orders.get(id)
+	if !ok {
+		ob.putReject(MsgModifyOrder, id, 0, decimal.Zero, decimal.Zero, ReasonNone, ErrOrderNotExists)
+		return
+	}
+
+	if !ob.state.accepts(o.Class, o.Flag) {
+		ob.putOrder(MsgModifyOrder, Rejected, o, newQty, o.Qty, ReasonNone, ErrSessionState)
+		return
+	}
+
+	if o.Class == Market {
+		// Market orders resting in an auction have no price
+		newPrice = o.Price
+	}
+
+	if err := ob.validateOrder(o.Class, o.Flag, newQty, newPrice, decimal.Zero, o.DisplayQty); err != nil {
+		ob.putOrder(MsgModifyOrder, Rejected, o, newQty, o.Qty, ReasonNone, err)
+		return
+	}
+
+	if o.Class != Market && newPrice.Equal(decimal.Zero) {
+		ob.putOrder(MsgModifyOrder, Rejected, o, newQty, o.Qty, ReasonNone, ErrInvalidPrice)
+		return
+	}
+
+	if newPrice.Equal(o.Price) && newQty.LessThanOrEqual(o.Qty) {
+		ob.updateQty(o, newQty)
+
+		ob.putOrder(MsgModifyOrder, Accepted, o, newQty, newQty, ReasonNone, nil)
+
+		if o.Flag&AoN != 0 && !ob.state.collects() {
+			// A smaller AoN order may now be fillable by the resting contra side
+			if o.Side == Buy {
+				ob.matchRestingAoN(Sell)
+			} else {
+				ob.matchRestingAoN(Buy)
+			}
+		}
+		return
+	}
+
+	if !ob.state.collects() && !ob.matching && ob.crosses(o.Side, newPrice) {
+		ob.putOrder(MsgModifyOrder, Rejected, o, newQty, o.Qty, ReasonNone, ErrNoMatching)
+		return
+	}
+
+	if o.Flag&PostOnly != 0 && !ob.state.collects() {
+		p, ok := ob.postOnlyPrice(o.Side, newPrice)
+		if !ok {
+			ob.putOrder(MsgModifyOrder, Rejected, o, newQty, o.Qty, ReasonNone, ErrPostOnly)
+			return
+		}
+		newPrice = p
+	}
+
+	o = ob.cancelOrder(id)
+	o.Qty = newQty
+	o.Price = newPrice
+	ob.putOrder(MsgModifyOrder, Accepted, o, newQty, newQty, ReasonNone, nil)
+	ob.processOrder(o)
 }
 
 // CancelOrder removes order with given ID from the order book
 func (ob *OrderBook) cancelOrder(orderID uint64) *Order {
 	o, ok := ob.orders.get(orderID)
 	if !ok {
-		return ob.cancelTrigOrders(orderID)
+		if o := ob.cancelTrigOrders(orderID); o != nil {
+			return o
+		}
+		return ob.cancelHeld(orderID)
 	}
 
 	ob.orders.remove(orderID)
 
-	if o.Side == Buy {
+	switch {
+	case o.Class == Market:
+		return ob.marketQueue(o.Side).Remove(o)
+	case o.Side == Buy:
 		return ob.bids.Remove(o)
+	default:
+		return ob.asks.Remove(o)
 	}
+}
 
-	return ob.asks.Remove(o)
+// updateQty changes the quantity of a resting order in place
+func (ob *OrderBook) updateQty(o *Order, qty decimal.Decimal) {
+	switch {
+	case o.Class == Market:
+		ob.marketQueue(o.Side).UpdateQty(o, qty)
+	case o.Side == Buy:
+		ob.bids.UpdateQty(o, qty)
+	default:
+		ob.asks.UpdateQty(o, qty)
+	}
 }
 
 func (ob *OrderBook) cancelTrigOrders(orderID uint64) *Order {
@@ -359,6 +839,9 @@ func (ob *OrderBook) Ask(tok uint64) *Order {
 	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
 		panic("invalid token received: cannot maintain determinism")
 	}
+	if ob.journal != nil {
+		ob.journal.token(tok)
+	}
 	orderQueue := ob.asks.MinPriceQueue()
 	if orderQueue == nil {
 		return nil
@@ -391,6 +874,9 @@ func (ob *OrderBook) Bid(tok uint64) *Order {
 	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
 		panic("invalid token received: cannot maintain determinism")
 	}
+	if ob.journal != nil {
+		ob.journal.token(tok)
+	}
 	orderQueue := ob.bids.MaxPriceQueue()
 	if orderQueue == nil {
 		return nil
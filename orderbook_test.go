@@ -97,6 +97,8 @@ func processLine(ob *OrderBook, line string) {
 		flag = TakeProfit
 	case "S":
 		flag = Snapshot
+	case "P":
+		flag = PostOnly
 	}
 
 	ob.AddOrder(tok, uint64(oid), class, side, qty, price, trigPrice, flag)
@@ -231,6 +233,7 @@ func TestLimitOrder_CreateIOCWithNoMatches(t *testing.T) {
 	processLine(ob, "300	L	S	1	200	0	I")
 	n.Verify(t, []string{
 		"CreateOrder Accepted 300 1",
+		"CreateOrder Canceled 300 1",
 	})
 }
 
@@ -266,6 +269,7 @@ func TestLimitOrder_CreateSell(t *testing.T) {
 		"2 340 FilledComplete FilledPartial 2 60",
 		"1 340 FilledComplete FilledPartial 2 50",
 		"CreateOrder Accepted 343 11",
+		"CreateOrder Canceled 343 11",
 	})
 }
 
@@ -320,6 +324,359 @@ func TestLimitOrder_ClearSellBestPriceFirst(t *testing.T) {
 	})
 }
 
+func TestModifyOrder_ReduceKeepsPriority(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	addDepth(ob, 1)
+	n.Reset()
+
+	ob.ModifyOrder(tok, 5, decimal.New(1, 0), decimal.New(90, 0))
+	tok++
+	processLine(ob, "800	M	S	2	0	0	N")
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 5 1",
+		"CreateOrder Accepted 800 2",
+		"5 800 FilledComplete FilledPartial 1 90",
+		"15 800 FilledPartial FilledComplete 1 90",
+	})
+}
+
+func TestModifyOrder_IncreaseLosesPriority(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	addDepth(ob, 1)
+	n.Reset()
+
+	ob.ModifyOrder(tok, 5, decimal.New(3, 0), decimal.New(90, 0))
+	tok++
+	processLine(ob, "800	M	S	3	0	0	N")
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 5 3",
+		"CreateOrder Accepted 800 3",
+		"15 800 FilledComplete FilledPartial 2 90",
+		"5 800 FilledPartial FilledComplete 1 90",
+	})
+
+	o := ob.Order(5)
+	require.NotNil(t, o)
+	assert.Equal(t, decimal.New(2, 0), o.Qty)
+}
+
+func TestModifyOrder_PriceChangeCrosses(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	ob.ModifyOrder(tok, 5, decimal.New(3, 0), decimal.New(100, 0))
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 5 3",
+		"6 5 FilledComplete FilledPartial 2 100",
+	})
+
+	o := ob.Order(5)
+	require.NotNil(t, o)
+	assert.Equal(t, decimal.New(1, 0), o.Qty)
+	assert.Equal(t, decimal.New(100, 0), o.Price)
+	assert.Equal(t, o, ob.Bid(tok))
+	tok++
+}
+
+func TestModifyOrder_Rejected(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	ob.ModifyOrder(tok, 500, decimal.New(3, 0), decimal.New(100, 0))
+	tok++
+	ob.ModifyOrder(tok, 5, decimal.Zero, decimal.New(100, 0))
+	tok++
+	ob.ModifyOrder(tok, 5, decimal.New(1, 0), decimal.Zero)
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Rejected 500 0 ErrOrderNotExists",
+		"ModifyOrder Rejected 5 0 ErrInvalidQuantity",
+		"ModifyOrder Rejected 5 1 ErrInvalidPrice",
+	})
+}
+
+func TestModifyOrder_NoMatching(t *testing.T) {
+	n := &Notification{}
+	ob := NewOrderBook(n, WithMatching(false))
+	tok = 1
+	addDepth(ob, 0)
+	n.Reset()
+
+	ob.ModifyOrder(tok, 5, decimal.New(2, 0), decimal.New(100, 0))
+	tok++
+	ob.ModifyOrder(tok, 5, decimal.New(2, 0), decimal.New(95, 0))
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Rejected 5 2 ErrNoMatching",
+		"ModifyOrder Accepted 5 2",
+	})
+	assert.Equal(t, decimal.New(95, 0), ob.Order(5).Price)
+}
+
+func addIceberg(ob *OrderBook, id uint64, side SideType, qty, displayQty, price int64) {
+	ob.AddOrderWithAttrs(tok, id, Limit, side, decimal.New(uint64(qty), 0), decimal.New(uint64(price), 0), decimal.Zero, None, OrderAttrs{
+		DisplayQty: decimal.New(uint64(displayQty), 0),
+	})
+	tok++
+}
+
+func TestIcebergOrder_Replenish(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	addIceberg(ob, 300, Sell, 10, 3, 100)
+	processLine(ob, "301	L	S	2	100	0	N")
+
+	assert.Equal(t, decimal.New(12, 0), ob.asks.Volume())
+	assert.Equal(t, decimal.New(5, 0), ob.asks.VisibleVolume())
+	assert.Equal(t, decimal.New(5, 0), ob.asks.GetQueue().VisibleQty())
+
+	processLine(ob, "800	M	B	4	0	0	N")
+	processLine(ob, "801	M	B	5	0	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 300 10",
+		"CreateOrder Accepted 301 2",
+		"CreateOrder Accepted 800 4",
+		"300 800 Replenished FilledPartial 3 100",
+		"301 800 FilledPartial FilledComplete 1 100",
+		"CreateOrder Accepted 801 5",
+		"301 801 FilledComplete FilledPartial 1 100",
+		"300 801 Replenished FilledPartial 3 100",
+		"300 801 FilledPartial FilledComplete 1 100",
+	})
+
+	o := ob.Order(300)
+	require.NotNil(t, o)
+	assert.Equal(t, decimal.New(3, 0), o.Qty)
+	assert.Equal(t, decimal.New(2, 0), o.Visible())
+	assert.Equal(t, decimal.New(3, 0), ob.asks.Volume())
+	assert.Equal(t, decimal.New(2, 0), ob.asks.VisibleVolume())
+}
+
+func TestIcebergOrder_Taker(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	addIceberg(ob, 300, Buy, 10, 4, 100)
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 300 10",
+		"6 300 FilledComplete FilledPartial 2 100",
+	})
+
+	o := ob.Order(300)
+	require.NotNil(t, o)
+	assert.Equal(t, decimal.New(8, 0), o.Qty)
+	assert.Equal(t, decimal.New(4, 0), o.Visible())
+	assert.Equal(t, decimal.New(18, 0), ob.bids.Volume())
+	assert.Equal(t, decimal.New(14, 0), ob.bids.VisibleVolume())
+
+	n.Reset()
+	ob.ModifyOrder(tok, 300, decimal.New(2, 0), decimal.New(100, 0))
+	tok++
+	ob.ModifyOrder(tok, 300, decimal.New(5, 0), decimal.New(100, 0))
+	tok++
+	n.Verify(t, []string{
+		"ModifyOrder Rejected 300 2 ErrInvalidDisplayQty",
+		"ModifyOrder Accepted 300 5",
+	})
+	assert.Equal(t, decimal.New(4, 0), o.Visible())
+	assert.Equal(t, decimal.New(15, 0), ob.bids.Volume())
+}
+
+func TestIcebergOrder_InvalidDisplayQty(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	addIceberg(ob, 300, Sell, 3, 4, 100)
+	ob.AddOrderWithAttrs(tok, 301, Limit, Sell, decimal.New(10, 0), decimal.New(100, 0), decimal.Zero, AoN, OrderAttrs{
+		DisplayQty: decimal.New(2, 0),
+	})
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 300 3 ErrInvalidDisplayQty",
+		"CreateOrder Rejected 301 10 ErrInvalidDisplayQty",
+	})
+}
+
+func TestPostOnly_Reject(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	processLine(ob, "300	L	B	1	100	0	P")
+	processLine(ob, "301	L	S	1	90	0	P")
+	processLine(ob, "302	M	B	1	0	0	P")
+	processLine(ob, "303	L	B	1	95	0	P")
+	ob.ModifyOrder(tok, 303, decimal.New(1, 0), decimal.New(100, 0))
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 300 1 ErrPostOnly",
+		"CreateOrder Rejected 301 1 ErrPostOnly",
+		"CreateOrder Rejected 302 1 ErrPostOnly",
+		"CreateOrder Accepted 303 1",
+		"ModifyOrder Rejected 303 1 ErrPostOnly",
+	})
+
+	assert.Equal(t, ob.Order(303), ob.Bid(tok))
+	tok++
+}
+
+func TestPostOnly_Slide(t *testing.T) {
+	n := &Notification{}
+	ob := NewOrderBook(n, WithPostOnlySlide(decimal.New(1, 0)))
+	tok = 1
+	addDepth(ob, 0)
+	n.Reset()
+
+	processLine(ob, "300	L	B	1	105	0	P")
+	processLine(ob, "301	L	S	1	85	0	P")
+	processLine(ob, "302	L	S	1	120	0	P")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 300 1",
+		"CreateOrder Accepted 301 1",
+		"CreateOrder Accepted 302 1",
+	})
+
+	assert.Equal(t, decimal.New(99, 0), ob.Order(300).Price)
+	assert.Equal(t, decimal.New(100, 0), ob.Order(301).Price) // one tick over the slid bid at 99
+	assert.Equal(t, decimal.New(120, 0), ob.Order(302).Price)
+}
+
+func TestAoN_RestingSkipped(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	processLine(ob, "1	L	S	5	100	0	A")
+	processLine(ob, "2	L	S	2	100	0	N")
+	processLine(ob, "3	L	S	2	110	0	N")
+	n.Reset()
+
+	processLine(ob, "4	M	B	3	0	0	N")
+	processLine(ob, "5	L	B	4	100	0	N")
+	processLine(ob, "6	L	B	1	100	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 4 3",
+		"2 4 FilledComplete FilledPartial 2 100",
+		"3 4 FilledPartial FilledComplete 1 110",
+		"CreateOrder Accepted 5 4",
+		"CreateOrder Accepted 6 1",
+		"5 1 FilledComplete FilledPartial 4 100",
+		"6 1 FilledComplete FilledComplete 1 100",
+	})
+
+	assert.Nil(t, ob.Order(1))
+	assert.Nil(t, ob.Order(5))
+	assert.Nil(t, ob.Order(6))
+	assert.Equal(t, uint64(0), ob.asks.numAoN)
+}
+
+func TestAoN_ReevaluatedOnContraLiquidity(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	processLine(ob, "1	L	B	10	100	0	A")
+	processLine(ob, "2	L	S	4	100	0	N")
+	processLine(ob, "3	L	S	6	99	0	N")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 10",
+		"CreateOrder Accepted 2 4",
+		"CreateOrder Accepted 3 6",
+		"3 1 FilledComplete FilledPartial 6 99",
+		"2 1 FilledComplete FilledComplete 4 100",
+	})
+
+	assert.Nil(t, ob.Ask(tok))
+	tok++
+	assert.Nil(t, ob.Bid(tok))
+	tok++
+}
+
+func TestAoN_ModifyReduceFills(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	processLine(ob, "1	L	B	10	100	0	A")
+	processLine(ob, "2	L	S	4	100	0	N")
+	n.Reset()
+
+	ob.ModifyOrder(tok, 1, decimal.New(4, 0), decimal.New(100, 0))
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 1 4",
+		"2 1 FilledComplete FilledComplete 4 100",
+	})
+	assert.Nil(t, ob.Order(1))
+}
+
+func TestAoN_TakerAcrossLevels(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	processLine(ob, "300	L	B	4	110	0	A")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 300 4",
+		"6 300 FilledComplete FilledPartial 2 100",
+		"7 300 FilledComplete FilledComplete 2 110",
+	})
+	assert.Nil(t, ob.Order(300))
+}
+
+func TestFoK_Limit(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	n.Reset()
+
+	processLine(ob, "300	L	B	5	120	0	F") // 6 available up to 120
+	processLine(ob, "301	L	B	7	120	0	F")
+	processLine(ob, "302	L	S	11	50	0	F")
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 300 5",
+		"6 300 FilledComplete FilledPartial 2 100",
+		"7 300 FilledComplete FilledPartial 2 110",
+		"8 300 FilledPartial FilledComplete 1 120",
+		"CreateOrder Rejected 301 7 ErrNotFillable",
+		"CreateOrder Rejected 302 11 ErrNotFillable",
+	})
+}
+
+func TestFoK_SkipsRestingAoN(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	processLine(ob, "1	L	S	5	100	0	A")
+	processLine(ob, "2	L	S	2	100	0	N")
+	n.Reset()
+
+	// 7 is resting at 100, but only 2 can be taken by an order for 4
+	processLine(ob, "3	L	B	4	100	0	F")
+	processLine(ob, "4	M	B	4	0	0	A")
+	processLine(ob, "5	M	B	7	0	0	F")
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 3 4 ErrNotFillable",
+		"CreateOrder Rejected 4 4 ErrNotFillable",
+		"CreateOrder Accepted 5 7",
+		"1 5 FilledComplete FilledPartial 5 100",
+		"2 5 FilledComplete FilledComplete 2 100",
+	})
+}
+
 func TestMarketProcess(t *testing.T) {
 	n, ob := getTestOrderBook()
 	addDepth(ob, 0)
@@ -342,13 +699,14 @@ func TestMarketProcess(t *testing.T) {
 		"3 802 FilledComplete FilledPartial 2 70",
 		"2 802 FilledComplete FilledPartial 2 60",
 		"1 802 FilledComplete FilledPartial 2 50",
-		// TODO Add notification for market order unable to be filled fully
-		"CreateOrder Accepted 803 12",
+		"CreateOrder Canceled 802 2",
+		"CreateOrder Rejected 803 12 ErrNotFillable",
 		"CreateOrder Accepted 804 12",
 		"7 804 FilledComplete FilledPartial 1 110",
 		"8 804 FilledComplete FilledPartial 2 120",
 		"9 804 FilledComplete FilledPartial 2 130",
 		"10 804 FilledComplete FilledPartial 2 140",
+		"CreateOrder Canceled 804 5",
 	})
 }
 
@@ -394,24 +752,34 @@ func TestStopPlace(t *testing.T) {
 		"CreateOrder Accepted 80 2",
 		"CreateOrder Accepted 90 2",
 		"CreateOrder Accepted 100 2",
+		"CreateOrder Triggered 100 2",
 		"CreateOrder Accepted 110 2",
+		"CreateOrder Triggered 110 2",
 		"CreateOrder Accepted 120 2",
+		"CreateOrder Triggered 120 2",
 		"CreateOrder Accepted 130 2",
+		"CreateOrder Triggered 130 2",
 		"CreateOrder Accepted 140 2",
+		"CreateOrder Triggered 140 2",
 		"CreateOrder Accepted 150 2",
 		"CreateOrder Accepted 160 2",
 		"CreateOrder Accepted 170 2",
 		"CreateOrder Accepted 180 2",
 		"CreateOrder Accepted 190 2",
 		"CreateOrder Accepted 2001 2",
+		"CreateOrder Triggered 2001 2",
 		"CreateOrder Accepted 2002 2",
 		"CreateOrder Accepted 2101 2",
+		"CreateOrder Triggered 2101 2",
 		"CreateOrder Accepted 2102 2",
 		"CreateOrder Accepted 2201 2",
+		"CreateOrder Triggered 2201 2",
 		"CreateOrder Accepted 2202 2",
 		"CreateOrder Accepted 2301 2",
+		"CreateOrder Triggered 2301 2",
 		"CreateOrder Accepted 2302 2",
 		"CreateOrder Accepted 2401 2",
+		"CreateOrder Triggered 2401 2",
 		"CreateOrder Accepted 2402 2",
 	})
 	assert.Nil(t, ob.Order(999))
@@ -441,12 +809,14 @@ func TestStopProcess(t *testing.T) {
 		"6 101 FilledComplete FilledComplete 2 100",
 		"CreateOrder Accepted 102 2",
 		"7 102 FilledComplete FilledComplete 2 110",
+		"CreateOrder Triggered 100 1",
 		"CreateOrder Accepted 103 2",
 		"100 103 FilledComplete FilledPartial 1 100",
 		"5 103 FilledPartial FilledComplete 1 90",
 		"CreateOrder Accepted 104 1",
 		"8 104 FilledPartial FilledComplete 1 120",
 		"CreateOrder Accepted 105 2",
+		"CreateOrder Triggered 105 2",
 		"8 105 FilledComplete FilledPartial 1 120",
 		"9 105 FilledPartial FilledComplete 1 130",
 		"CreateOrder Accepted 106 1",
@@ -454,6 +824,7 @@ func TestStopProcess(t *testing.T) {
 		"CreateOrder Accepted 107 1",
 		"5 107 FilledComplete FilledComplete 1 90",
 		"CreateOrder Accepted 206 2",
+		"CreateOrder Triggered 206 2",
 		"4 206 FilledComplete FilledComplete 2 80",
 		"CreateOrder Accepted 207 1",
 		"3 207 FilledPartial FilledComplete 1 70",
@@ -481,6 +852,7 @@ func TestStopProcess_Limit(t *testing.T) {
 		"6 102 FilledComplete FilledComplete 1 100",
 		"CreateOrder Accepted 103 2",
 		"5 103 FilledComplete FilledComplete 2 90",
+		"CreateOrder Triggered 101 1",
 		"CreateOrder Accepted 104 1",
 		"101 104 FilledComplete FilledComplete 1 90",
 		"CreateOrder Accepted 105 1",
@@ -508,6 +880,7 @@ func TestStopProcess_Market(t *testing.T) {
 		"6 102 FilledComplete FilledComplete 1 100",
 		"CreateOrder Accepted 103 2",
 		"5 103 FilledComplete FilledComplete 2 90",
+		"CreateOrder Triggered 101 1",
 		"4 101 FilledPartial FilledComplete 1 80",
 		"CreateOrder Accepted 104 1",
 		"7 104 FilledPartial FilledComplete 1 110",
@@ -516,6 +889,23 @@ func TestStopProcess_Market(t *testing.T) {
 	})
 }
 
+func TestStopProcess_Direction(t *testing.T) {
+	_, ob := getTestOrderBook()
+	addDepth(ob, 0)
+
+	processLine(ob, "100	M	B	1	0	0	N") // @ LP 100.
+	processLine(ob, "101	M	S	1	0	90	SL")
+	processLine(ob, "102	M	B	1	0	110	SL")
+	processLine(ob, "103	M	B	1	0	0	N") // @ LP 100. Neither stop triggers
+
+	assert.NotNil(t, ob.Order(101))
+	assert.NotNil(t, ob.Order(102))
+
+	processLine(ob, "104	M	B	3	0	0	N") // @ LP 110. SL B trigger
+	assert.NotNil(t, ob.Order(101))
+	assert.Nil(t, ob.Order(102))
+}
+
 func TestOrderBook_Ask(t *testing.T) {
 	n, ob := getTestOrderBook()
 	n.Reset()
@@ -719,6 +1109,32 @@ func (o orderNotification) String() string {
 			errName = "ErrNoMatching"
 		case ErrInvalidTriggerPrice:
 			errName = "ErrInvalidTriggerPrice"
+		case ErrInvalidDisplayQty:
+			errName = "ErrInvalidDisplayQty"
+		case ErrPostOnly:
+			errName = "ErrPostOnly"
+		case ErrSelfTrade:
+			errName = "ErrSelfTrade"
+		case ErrNotFillable:
+			errName = "ErrNotFillable"
+		case ErrOrderExpired:
+			errName = "ErrOrderExpired"
+		case ErrInvalidTrail:
+			errName = "ErrInvalidTrail"
+		case ErrLinkedOrder:
+			errName = "ErrLinkedOrder"
+		case ErrInvalidJournal:
+			errName = "ErrInvalidJournal"
+		case ErrSessionState:
+			errName = "ErrSessionState"
+		case ErrTickSize:
+			errName = "ErrTickSize"
+		case ErrLotSize:
+			errName = "ErrLotSize"
+		case ErrQtyOutOfRange:
+			errName = "ErrQtyOutOfRange"
+		case ErrMaxNotional:
+			errName = "ErrMaxNotional"
 		}
 
 		return fmt.Sprintf("%s %s %d %s %s", o.MsgType, o.Status, o.OrderID, o.Qty.String(), errName)
@@ -10,18 +10,20 @@ type orderQueue struct {
 	head *Order
 	tail *Order
 
-	totalQty decimal.Decimal
-	price    decimal.Decimal
+	totalQty   decimal.Decimal
+	visibleQty decimal.Decimal
+	price      decimal.Decimal
 }
 
-// newOrderQueue creates and initialize orderQueue object
-func newOrderQueue(price decimal.Decimal) *orderQueue {
-	q := oqPool.Get()
+// newOrderQueue creates and initialize orderQueue object from pools
+func newOrderQueue(pools *Pools, price decimal.Decimal) *orderQueue {
+	q := pools.getQueue()
 	q.size = 0
 	q.head = nil
 	q.tail = nil
 	q.price = price
 	q.totalQty = decimal.Zero
+	q.visibleQty = decimal.Zero
 
 	return q
 }
@@ -36,23 +38,25 @@ func (oq *orderQueue) Price() decimal.Decimal {
 	return oq.price
 }
 
-// TotalQty returns total order qty
+// TotalQty returns total order qty including the hidden reserve of iceberg orders
 func (oq *orderQueue) TotalQty() decimal.Decimal {
 	return oq.totalQty
 }
 
+// VisibleQty returns total displayed order qty
+func (oq *orderQueue) VisibleQty() decimal.Decimal {
+	return oq.visibleQty
+}
+
 // Head returns top order in queue
 func (oq *orderQueue) Head() *Order {
 	return oq.head
 }
 
-func (oq *orderQueue) Release() {
-	oqPool.Put(oq)
-}
-
 // Append adds order to tail of the queue
 func (oq *orderQueue) Append(o *Order) *Order {
 	oq.totalQty = oq.totalQty.Add(o.Qty)
+	oq.visibleQty = oq.visibleQty.Add(o.Visible())
 	tail := oq.tail
 	oq.tail = o
 	if tail != nil {
@@ -66,9 +70,32 @@ func (oq *orderQueue) Append(o *Order) *Order {
 	return o
 }
 
+// UpdateQty changes the quantity of an order without moving it in the queue.
+// The displayed peak of an iceberg order is capped at the new quantity.
+func (oq *orderQueue) UpdateQty(o *Order, qty decimal.Decimal) {
+	oq.totalQty = oq.totalQty.Sub(o.Qty).Add(qty)
+	oq.visibleQty = oq.visibleQty.Sub(o.Visible())
+	o.Qty = qty
+	if o.visibleQty.GreaterThan(qty) {
+		o.visibleQty = qty
+	}
+	oq.visibleQty = oq.visibleQty.Add(o.Visible())
+}
+
+// fill removes a traded quantity from an order's displayed and total quantity
+func (oq *orderQueue) fill(o *Order, qty decimal.Decimal) {
+	oq.totalQty = oq.totalQty.Sub(qty)
+	oq.visibleQty = oq.visibleQty.Sub(qty)
+	o.Qty = o.Qty.Sub(qty)
+	if !o.DisplayQty.IsZero() {
+		o.visibleQty = o.visibleQty.Sub(qty)
+	}
+}
+
 // Remove removes order from the queue and link order chain
 func (oq *orderQueue) Remove(o *Order) *Order {
 	oq.totalQty = oq.totalQty.Sub(o.Qty)
+	oq.visibleQty = oq.visibleQty.Sub(o.Visible())
 	prev := o.prev
 	next := o.next
 	if prev != nil {
@@ -90,33 +117,100 @@ func (oq *orderQueue) Remove(o *Order) *Order {
 	return o
 }
 
-func (oq *orderQueue) process(ob *OrderBook, takerOrderID uint64, qty decimal.Decimal) (ordersClosed int, qtyProcessed decimal.Decimal) {
-	for ho := oq.head; ho != nil && qty.GreaterThan(decimal.Zero); ho = oq.head {
-		switch qty.Cmp(ho.Qty) {
-		case -1:
-			qtyProcessed = qtyProcessed.Add(qty)
-			ho.Qty = ho.Qty.Sub(qty)
-			oq.totalQty = oq.totalQty.Sub(qty)
-			ob.notification.PutTrade(ho.ID, takerOrderID, FilledPartial, FilledComplete, qty, ho.Price)
-			ob.lastPrice = ho.Price
-			return
-		case 1:
-			qtyProcessed = qtyProcessed.Add(ho.Qty)
-			qty = qty.Sub(ho.Qty)
-			ob.cancelOrder(ho.ID)
-			ob.notification.PutTrade(ho.ID, takerOrderID, FilledComplete, FilledPartial, ho.Qty, ho.Price)
-			ob.lastPrice = ho.Price
-			ordersClosed++
-			ho.Release()
-		case 0:
-			qtyProcessed = qtyProcessed.Add(ho.Qty)
-			qty = qty.Sub(ho.Qty)
-			ob.cancelOrder(ho.ID)
-			ob.notification.PutTrade(ho.ID, takerOrderID, FilledComplete, FilledComplete, ho.Qty, ho.Price)
-			ob.lastPrice = ho.Price
-			ordersClosed++
-			ho.Release()
+// hasOwner reports whether an order of owner rests in the queue
+func (oq *orderQueue) hasOwner(owner uint64) bool {
+	for o := oq.head; o != nil; o = o.next {
+		if o.Owner == owner {
+			return true
 		}
 	}
+	return false
+}
+
+// process matches qty of the taker order against the queue with the matching
+// algorithm of the book. The returned qtyProcessed is the quantity removed from
+// the taker, which includes any quantity canceled by self-trade prevention.
+func (oq *orderQueue) process(ob *OrderBook, pl *priceLevel, taker *Order, qty decimal.Decimal) (qtyProcessed decimal.Decimal) {
+	if ob.proRata != nil {
+		return oq.processProRata(ob, pl, taker, qty)
+	}
+
+	return oq.processFIFO(ob, pl, taker, qty, qty)
+}
+
+// processFIFO matches up to qty of the taker order, which has left to fill in
+// total, against the queue in time priority. Resting AoN orders that qty
+// cannot fill entirely are skipped and keep their position.
+func (oq *orderQueue) processFIFO(ob *OrderBook, pl *priceLevel, taker *Order, qty, left decimal.Decimal) (qtyProcessed decimal.Decimal) {
+	for ho := oq.head; ho != nil && qty.GreaterThan(decimal.Zero); {
+		next := ho.next
+
+		if ho.canceled {
+			// Leg of an OCO group that fired during this match
+			ho = next
+			continue
+		}
+
+		if ob.stpMode != STPNone && taker.Owner != 0 && ho.Owner == taker.Owner {
+			q := ob.preventSelfTrade(pl, ho, taker, qty)
+			qtyProcessed = qtyProcessed.Add(q)
+			qty = qty.Sub(q)
+			left = left.Sub(q)
+			ho = next
+			continue
+		}
+
+		if ho.Flag&AoN != 0 && qty.LessThan(ho.Qty) {
+			ho = next
+			continue
+		}
+
+		fill := ho.Visible()
+		if qty.LessThan(fill) {
+			fill = qty
+		}
+		replenished := fill.LessThan(ho.Qty) && fill.Equal(ho.Visible())
+
+		oq.trade(ob, pl, ho, taker, fill, left)
+		qtyProcessed = qtyProcessed.Add(fill)
+		qty = qty.Sub(fill)
+		left = left.Sub(fill)
+
+		if replenished && next == nil {
+			// ho was already the tail, so it is next in line again
+			next = ho
+		}
+		ho = next
+	}
 	return
 }
+
+// trade fills qty of the taker order, which has left to fill in total, against
+// the resting order ho. qty must not exceed the displayed quantity of ho.
+func (oq *orderQueue) trade(ob *OrderBook, pl *priceLevel, ho, taker *Order, qty, left decimal.Decimal) {
+	left = left.Sub(qty)
+	takerStatus := FilledPartial
+	if left.IsZero() {
+		takerStatus = FilledComplete
+	}
+
+	switch {
+	case qty.Equal(ho.Qty):
+		ob.cancelOrder(ho.ID)
+		ob.putTrade(ho, taker, FilledComplete, takerStatus, qty, decimal.Zero, left)
+		ob.fireGroups(ho, taker)
+		ob.filled(ho)
+		ob.release(ho)
+	case qty.Equal(ho.Visible()):
+		// The displayed peak of an iceberg order is exhausted. Replenish it
+		// from the reserve and move the order to the back of the queue.
+		pl.fill(ho, qty)
+		pl.refresh(ho)
+		ob.putTrade(ho, taker, Replenished, takerStatus, qty, ho.Qty, left)
+		ob.fireGroups(ho, taker)
+	default:
+		pl.fill(ho, qty)
+		ob.putTrade(ho, taker, FilledPartial, takerStatus, qty, ho.Qty, left)
+		ob.fireGroups(ho, taker)
+	}
+}
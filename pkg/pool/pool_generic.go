@@ -21,7 +21,6 @@ func NewItemPoolV2[T any](maxSize uint64) *ItemPoolV2[T] {
 
 	// Prepopulate the pool
 	for !ch.IsFull() {
-		//println("Here1")
 		ch.Put(new(T))
 	}
 
@@ -80,28 +79,57 @@ func NewItemChanV2[T any](size uint64) *ItemChanV2[T] {
 
 // Put inserts an item into the channel at the next free position
 func (c *ItemChanV2[T]) Put(value *T) {
-	// Wait for the reader to catch up if the channel is full
-	for atomic.LoadUint64(&c.nextFreeIndex)+1 > (atomic.LoadUint64(&c.readerIndex) + c.indexMask) {
-		println("Here2")
-		runtime.Gosched()
+	myIndex := c.claim()
+	c.contents[myIndex&c.indexMask] = value
+	c.commit(myIndex)
+}
+
+// PutWith claims the next free position, lets fill write the item stored there
+// in place and makes it available for reading. Items are allocated on first
+// use and reused whenever the position comes around again, so fill must set
+// every field the reader relies on, and the reader must be done with an item
+// before its next call to Read. PutWith and Put must not be mixed on the same
+// channel.
+func (c *ItemChanV2[T]) PutWith(fill func(item *T)) {
+	myIndex := c.claim()
+	item := c.contents[myIndex&c.indexMask]
+	if item == nil {
+		item = new(T)
+		c.contents[myIndex&c.indexMask] = item
 	}
+	fill(item)
+	c.commit(myIndex)
+}
 
-	// Add the item to the next available slot
-	var myIndex = atomic.AddUint64(&c.nextFreeIndex, 1)
-	c.contents[myIndex&c.indexMask] = value
+// claim reserves the next free position for a writer, waiting for the reader
+// to catch up if the channel is full. It is safe for concurrent writers.
+func (c *ItemChanV2[T]) claim() uint64 {
+	for {
+		next := atomic.LoadUint64(&c.nextFreeIndex)
+		if next+1 > atomic.LoadUint64(&c.readerIndex)+c.indexMask {
+			runtime.Gosched()
+			continue
+		}
+
+		if atomic.CompareAndSwapUint64(&c.nextFreeIndex, next, next+1) {
+			return next + 1
+		}
+	}
+}
 
-	// Update the last committed index to make the item available for reading
+// commit makes the item at myIndex available for reading once every position
+// claimed before it was committed
+func (c *ItemChanV2[T]) commit(myIndex uint64) {
 	for !atomic.CompareAndSwapUint64(&c.lastCommittedIndex, myIndex-1, myIndex) {
-		println("Here3")
 		runtime.Gosched()
 	}
 }
 
-// Read removes and returns an item from the channel
+// Read removes and returns an item from the channel. There must be a single
+// reader.
 func (c *ItemChanV2[T]) Read() *T {
 	// Wait for a committed item if the reader has outpaced the writer
 	for atomic.LoadUint64(&c.readerIndex)+1 > atomic.LoadUint64(&c.lastCommittedIndex) {
-		println("Here4")
 		runtime.Gosched()
 	}
 
@@ -8,3 +8,6 @@ type PoolInterface[T any] interface {
 
 // Ensure that ItemPoolV2 implements PoolInterface
 var _ PoolInterface[any] = (*ItemPoolV2[any])(nil)
+
+// Ensure that LazyItemPool implements PoolInterface
+var _ PoolInterface[any] = (*LazyItemPool[any])(nil)
@@ -0,0 +1,38 @@
+package pool
+
+// LazyItemPool is an item pool that allocates items on demand instead of
+// prepopulating them. Up to maxSize items that are put back are kept for
+// reuse, so memory grows with the number of items in use rather than being
+// reserved upfront. It is not safe for concurrent use.
+type LazyItemPool[T any] struct {
+	items   []*T
+	maxSize uint64
+}
+
+// NewLazyItemPool creates an empty pool that keeps up to maxSize items
+func NewLazyItemPool[T any](maxSize uint64) *LazyItemPool[T] {
+	return &LazyItemPool[T]{maxSize: maxSize}
+}
+
+// Get retrieves an item from the pool, or creates a new one if the pool is empty
+func (p *LazyItemPool[T]) Get() *T {
+	n := len(p.items)
+	if n == 0 {
+		return new(T)
+	}
+
+	o := p.items[n-1]
+	p.items[n-1] = nil
+	p.items = p.items[:n-1]
+	return o
+}
+
+// Put returns an item back to the pool
+func (p *LazyItemPool[T]) Put(o *T) {
+	// If the pool is full, let the garbage collector handle the item
+	if o == nil || uint64(len(p.items)) >= p.maxSize {
+		return
+	}
+
+	p.items = append(p.items, o)
+}
@@ -45,6 +45,21 @@ func NewWithTree[K Number, V any](comparator comparatorTree[K], maxSize uint64)
 	return &Tree[K, V]{Comparator: comparator, Pool: pool.NewItemPoolV2[nodeTree[K, V]](maxSize)}
 }
 
+// NodePool is a pool of nodes that trees of the same type can share
+type NodePool[K Number, V any] pool.PoolInterface[nodeTree[K, V]]
+
+// NewNodePool creates a pool that allocates nodes on demand and keeps up to
+// maxSize released nodes for reuse
+func NewNodePool[K Number, V any](maxSize uint64) NodePool[K, V] {
+	return pool.NewLazyItemPool[nodeTree[K, V]](maxSize)
+}
+
+// NewWithPool instantiates a red-black tree with the custom comparator that
+// allocates its nodes from p.
+func NewWithPool[K Number, V any](comparator comparatorTree[K], p NodePool[K, V]) *Tree[K, V] {
+	return &Tree[K, V]{Comparator: comparator, Pool: p}
+}
+
 func newNodeTree[K Number, V any](key K, value V, color colorTree, local_pool pool.PoolInterface[nodeTree[K, V]]) *nodeTree[K, V] {
 	nt := local_pool.Get()
 	nt.Key = key
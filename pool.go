@@ -1 +1,101 @@
 package orderbook
+
+import (
+	"github.com/geseq/orderbook/pkg/pool"
+	local_tree "github.com/geseq/orderbook/pkg/tree"
+	decimal "github.com/geseq/udecimal"
+)
+
+// Pools holds the orders, order queues and price tree nodes that order books
+// draw from. A Pools may be shared by several books as long as they are all
+// driven from the same goroutine.
+type Pools struct {
+	orders pool.PoolInterface[Order]
+	queues pool.PoolInterface[orderQueue]
+	nodes  local_tree.NodePool[decimal.Decimal, *orderQueue]
+	attrs  pool.PoolInterface[OrderAttrs]
+}
+
+// NewPools creates pools with orderPoolSize orders and orderQueuePoolSize
+// order queues preallocated. Every order queue sits in one node of a price
+// tree, so as many tree nodes as order queues are preallocated. The optional
+// attributes of orders, which most orders do not have, are allocated on
+// demand.
+func NewPools(orderPoolSize, orderQueuePoolSize uint64) *Pools {
+	return &Pools{
+		orders: pool.NewItemPoolV2[Order](orderPoolSize),
+		queues: pool.NewItemPoolV2[orderQueue](orderQueuePoolSize),
+		nodes:  local_tree.NewWithTree[decimal.Decimal, *orderQueue](Comparator, orderQueuePoolSize).Pool,
+		attrs:  pool.NewLazyItemPool[OrderAttrs](orderPoolSize),
+	}
+}
+
+// newLazyPools creates pools that allocate on demand and keep up to the given
+// number of released items for reuse
+func newLazyPools(orderPoolSize, orderQueuePoolSize, nodePoolSize uint64) *Pools {
+	return &Pools{
+		orders: pool.NewLazyItemPool[Order](orderPoolSize),
+		queues: pool.NewLazyItemPool[orderQueue](orderQueuePoolSize),
+		nodes:  local_tree.NewNodePool[decimal.Decimal, *orderQueue](nodePoolSize),
+		attrs:  pool.NewLazyItemPool[OrderAttrs](orderPoolSize),
+	}
+}
+
+// getOrder returns an order from the pools. Without pools a new order is
+// allocated.
+func (p *Pools) getOrder() *Order {
+	if p == nil {
+		return new(Order)
+	}
+	o := p.orders.Get()
+	o.pools = p
+	return o
+}
+
+// putOrder returns o, which must have been reset, to the pools
+func (p *Pools) putOrder(o *Order) {
+	if p != nil {
+		p.orders.Put(o)
+	}
+}
+
+// getAttrs returns storage for the optional attributes of an order
+func (p *Pools) getAttrs() *OrderAttrs {
+	if p == nil {
+		return new(OrderAttrs)
+	}
+	return p.attrs.Get()
+}
+
+// putAttrs clears a and returns it to the pools
+func (p *Pools) putAttrs(a *OrderAttrs) {
+	*a = OrderAttrs{}
+	if p != nil {
+		p.attrs.Put(a)
+	}
+}
+
+// getQueue returns an order queue from the pools. Without pools a new queue is
+// allocated.
+func (p *Pools) getQueue() *orderQueue {
+	if p == nil {
+		return new(orderQueue)
+	}
+	return p.queues.Get()
+}
+
+// putQueue returns q to the pools
+func (p *Pools) putQueue(q *orderQueue) {
+	if p != nil {
+		p.queues.Put(q)
+	}
+}
+
+// nodePool returns the pool of price tree nodes. Without pools every node is
+// allocated.
+func (p *Pools) nodePool() local_tree.NodePool[decimal.Decimal, *orderQueue] {
+	if p == nil {
+		return local_tree.NewNodePool[decimal.Decimal, *orderQueue](0)
+	}
+	return p.nodes
+}
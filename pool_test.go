@@ -0,0 +1,56 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPools_PerBook(t *testing.T) {
+	opts := []Option{WithOrderPoolSize(4), WithOrderQueuePoolSize(4), WithNodeTreePoolSize(4), WithOrderTreeNodePoolSIze(4)}
+	n1 := &Notification{}
+	ob1 := NewOrderBook(n1, opts...)
+	ob2 := NewOrderBook(&EmptyNotification{}, opts...)
+	assert.NotSame(t, ob1.pools, ob2.pools)
+	assert.Same(t, ob1.bids.priceTree.Pool, ob1.triggerOver.priceTree.Pool)
+	assert.NotSame(t, ob1.bids.priceTree.Pool, ob2.bids.priceTree.Pool)
+
+	// Orders released by one book never end up in the other
+	for i := uint64(0); i < 8; i++ {
+		ob1.AddOrder(2*i+1, 1, Limit, Buy, decimal.New(1, 0), decimal.New(100, 0), decimal.Zero, None)
+		ob2.AddOrder(2*i+1, 1, Limit, Sell, decimal.New(1, 0), decimal.New(90, 0), decimal.Zero, None)
+		ob1.AddOrder(2*i+2, 2, Limit, Sell, decimal.New(1, 0), decimal.New(100, 0), decimal.Zero, None)
+		ob2.AddOrder(2*i+2, 2, Limit, Buy, decimal.New(1, 0), decimal.New(90, 0), decimal.Zero, None)
+	}
+
+	assert.Len(t, n1.Strings(), 8*3)
+	assert.Equal(t, uint64(0), ob1.bids.Len()+ob1.asks.Len())
+	assert.Equal(t, uint64(0), ob2.bids.Len()+ob2.asks.Len())
+
+	shared := NewPools(4, 4)
+	ob3 := NewOrderBook(&EmptyNotification{}, WithPools(shared))
+	ob4 := NewOrderBook(&EmptyNotification{}, WithPools(shared))
+	assert.Same(t, ob3.pools, ob4.pools)
+
+	e := NewExchange(nil)
+	b1, _ := e.AddBook(1, &EmptyNotification{}, opts...)
+	b2, _ := e.AddBook(2, &EmptyNotification{}, opts...)
+	assert.NotSame(t, b1.pools, b2.pools)
+}
+
+func TestPools_Release(t *testing.T) {
+	p := newLazyPools(4, 4, 4)
+	o := p.getOrder().set(1, Limit, Buy, decimal.New(1, 0), decimal.New(100, 0), decimal.Zero, None)
+	assert.Same(t, p, o.pools)
+
+	o.Release()
+	assert.Equal(t, uint64(0), o.ID)
+	assert.Nil(t, o.pools)
+	assert.Same(t, o, p.getOrder())
+
+	// Orders created outside of a book are only cleared
+	o = NewOrder(2, Limit, Sell, decimal.New(1, 0), decimal.New(100, 0), decimal.Zero, None)
+	o.Release()
+	assert.Equal(t, uint64(0), o.ID)
+}
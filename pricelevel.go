@@ -11,9 +11,23 @@ type priceLevel struct {
 	priceTree *local_tree.Tree[decimal.Decimal, *orderQueue]
 	priceType PriceType
 
-	volume    decimal.Decimal
-	numOrders uint64
-	depth     int
+	volume        decimal.Decimal
+	visibleVolume decimal.Decimal
+	numOrders     uint64
+	numAoN        uint64
+	depth         int
+
+	// trailing indexes the trailing stops of a trigger level by order id so
+	// that they can be adjusted without walking the whole level. It is nil for
+	// bids and asks.
+	trailing *local_tree.Tree[uint64, *Order]
+
+	hashed bool        // maintain hash as orders change, see WithStateHash
+	hash   uint64      // sum of the orderHash of every order in the level
+	bits   decimalBits // scratch space for orderHash
+
+	pools *Pools
+	md    *marketData // nil unless a MarketDataHandler is set for bids and asks
 }
 
 // Comparator compares two Decimal objects
@@ -38,12 +52,14 @@ const (
 	TakePrice
 )
 
-// newPriceLevel creates new priceLevel manager
-func newPriceLevel(priceType PriceType) *priceLevel {
+// newPriceLevel creates new priceLevel manager that allocates from pools
+func newPriceLevel(priceType PriceType, pools *Pools) *priceLevel {
 	return &priceLevel{
-		priceTree: local_tree.NewWithTree[udecimal.Decimal, *orderQueue](Comparator, 1),
-		priceType: priceType,
-		volume:    decimal.Zero,
+		priceTree:     local_tree.NewWithPool[udecimal.Decimal, *orderQueue](Comparator, pools.nodePool()),
+		priceType:     priceType,
+		volume:        decimal.Zero,
+		visibleVolume: decimal.Zero,
+		pools:         pools,
 	}
 }
 
@@ -57,25 +73,45 @@ func (pl *priceLevel) Depth() int {
 	return pl.depth
 }
 
-// Volume returns total amount of quantity in side
+// Volume returns total amount of quantity in side including the hidden
+// reserve of iceberg orders
 func (pl *priceLevel) Volume() decimal.Decimal {
 	return pl.volume
 }
 
+// VisibleVolume returns total amount of displayed quantity in side
+func (pl *priceLevel) VisibleVolume() decimal.Decimal {
+	return pl.visibleVolume
+}
+
 // Append appends order to definite price level
 func (pl *priceLevel) Append(o *Order) *Order {
 	price := o.GetPrice(pl.priceType)
 
 	priceQueue, ok := pl.priceTree.Get(price)
 	if !ok {
-		priceQueue = newOrderQueue(price)
+		priceQueue = newOrderQueue(pl.pools, price)
 		pl.priceTree.Put(price, priceQueue)
 		pl.depth++
 	}
 	pl.numOrders++
+	if o.Flag&AoN != 0 {
+		pl.numAoN++
+	}
+	if pl.trailing != nil && o.TrailType != TrailNone {
+		pl.trailing.Put(o.ID, o)
+	}
 	pl.volume = pl.volume.Add(o.Qty)
+	pl.visibleVolume = pl.visibleVolume.Add(o.Visible())
 	o.queue = priceQueue
-	return priceQueue.Append(o)
+	priceQueue.Append(o)
+	pl.addHash(o)
+
+	if pl.md != nil {
+		pl.md.order(pl, ActionAdd, o)
+		pl.md.level(pl, priceQueue, !ok)
+	}
+	return o
 }
 
 // Remove removes order from definite price level
@@ -84,17 +120,78 @@ func (pl *priceLevel) Remove(o *Order) *Order {
 
 	priceQueue := o.queue
 	o = priceQueue.Remove(o)
+	pl.subHash(o)
+	if pl.md != nil {
+		pl.md.order(pl, ActionDelete, o)
+		pl.md.level(pl, priceQueue, false)
+	}
 	if priceQueue.Len() == 0 {
 		pl.priceTree.Remove(price)
 		pl.depth--
-		priceQueue.Release()
+		pl.pools.putQueue(priceQueue)
 	}
 
 	pl.numOrders--
+	if o.Flag&AoN != 0 {
+		pl.numAoN--
+	}
+	if pl.trailing != nil && o.TrailType != TrailNone {
+		pl.trailing.Remove(o.ID)
+	}
 	pl.volume = pl.volume.Sub(o.Qty)
+	pl.visibleVolume = pl.visibleVolume.Sub(o.Visible())
 	return o
 }
 
+// UpdateQty changes the quantity of an order in place without affecting its
+// position in the queue
+func (pl *priceLevel) UpdateQty(o *Order, qty decimal.Decimal) {
+	pl.volume = pl.volume.Sub(o.Qty).Add(qty)
+	pl.visibleVolume = pl.visibleVolume.Sub(o.Visible())
+	pl.subHash(o)
+	o.queue.UpdateQty(o, qty)
+	pl.addHash(o)
+	pl.visibleVolume = pl.visibleVolume.Add(o.Visible())
+
+	if pl.md != nil {
+		pl.md.order(pl, ActionChange, o)
+		pl.md.level(pl, o.queue, false)
+	}
+}
+
+// fill removes a traded quantity from an order resting at this level
+func (pl *priceLevel) fill(o *Order, qty decimal.Decimal) {
+	pl.volume = pl.volume.Sub(qty)
+	pl.visibleVolume = pl.visibleVolume.Sub(qty)
+	pl.subHash(o)
+	o.queue.fill(o, qty)
+	pl.addHash(o)
+
+	// An iceberg order whose peak was used up is published by refresh
+	if pl.md != nil && !o.Visible().IsZero() {
+		pl.md.order(pl, ActionChange, o)
+		pl.md.level(pl, o.queue, false)
+	}
+}
+
+// refresh replenishes the displayed peak of an iceberg order and moves it to
+// the tail of its queue, losing time priority
+func (pl *priceLevel) refresh(o *Order) {
+	q := o.queue
+	q.Remove(o)
+	pl.subHash(o)
+	o.refresh()
+	pl.addHash(o)
+	q.Append(o)
+	pl.visibleVolume = pl.visibleVolume.Add(o.Visible())
+
+	if pl.md != nil {
+		pl.md.order(pl, ActionDelete, o)
+		pl.md.order(pl, ActionAdd, o)
+		pl.md.level(pl, q, false)
+	}
+}
+
 // MaxPriceQueue returns maximal level of price
 func (pl *priceLevel) MaxPriceQueue() *orderQueue {
 	if pl.depth > 0 {
@@ -190,58 +287,95 @@ func (pl *priceLevel) GetNextQueue(price decimal.Decimal) *orderQueue {
 	}
 }
 
-func (pl *priceLevel) processMarketOrder(ob *OrderBook, takerOrderID uint64, qty decimal.Decimal, flag FlagType) (qtyProcessed decimal.Decimal) {
+// fillable returns how much of qty could be filled against this side at prices
+// accepted by compare. Resting AoN orders that the remaining quantity could not
+// fill entirely are skipped, exactly as they are during matching, and so are
+// the orders that self-trade prevention resolves as described by st.
+func (pl *priceLevel) fillable(compare func(price decimal.Decimal) bool, qty decimal.Decimal, st selfTrade) decimal.Decimal {
+	left := qty
+	for q := pl.GetQueue(); q != nil && left.GreaterThan(decimal.Zero) && compare(q.Price()); q = pl.GetNextQueue(q.Price()) {
+		if st.owner == 0 && left.GreaterThanOrEqual(q.TotalQty()) {
+			left = left.Sub(q.TotalQty())
+			continue
+		}
+
+		if st.stop && st.byLevel && q.hasOwner(st.owner) {
+			break
+		}
+
+		for o := q.Head(); o != nil && left.GreaterThan(decimal.Zero); o = o.next {
+			if st.owner != 0 && o.Owner == st.owner {
+				if st.stop {
+					return qty.Sub(left)
+				}
+				continue
+			}
+
+			if o.Qty.LessThanOrEqual(left) {
+				left = left.Sub(o.Qty)
+			} else if o.Flag&AoN == 0 {
+				left = decimal.Zero
+			}
+		}
+	}
+
+	return qty.Sub(left)
+}
+
+// canFill returns true if qty can be filled entirely against this side at
+// prices accepted by compare
+func (pl *priceLevel) canFill(compare func(price decimal.Decimal) bool, qty decimal.Decimal, st selfTrade) bool {
+	if qty.GreaterThan(pl.Volume()) {
+		return false
+	}
+
+	return pl.fillable(compare, qty, st).Equal(qty)
+}
+
+// anyPrice accepts every price level; it is the price limit of market orders
+func anyPrice(decimal.Decimal) bool {
+	return true
+}
+
+func (pl *priceLevel) processMarketOrder(ob *OrderBook, taker *Order) (qtyProcessed decimal.Decimal) {
+	qty, flag := taker.Qty, taker.Flag
 
-	// TODO: This wont work as  priceLevel volumes aren't accounted for corectly
-	if flag&(AoN|FoK) != 0 && qty.GreaterThan(pl.Volume()) {
+	if flag&(AoN|FoK) != 0 && !pl.canFill(anyPrice, qty, ob.selfTrade(taker.Owner)) {
 		return decimal.Zero
 	}
 
 	qtyLeft := qty
 	qtyProcessed = decimal.Zero
-	for orderQueue := pl.GetQueue(); qtyLeft.GreaterThan(decimal.Zero) && orderQueue != nil; orderQueue = pl.GetQueue() {
-		_, q := orderQueue.process(ob, takerOrderID, qtyLeft)
+	for orderQueue := pl.GetQueue(); qtyLeft.GreaterThan(decimal.Zero) && orderQueue != nil; {
+		price := orderQueue.Price()
+		q := orderQueue.process(ob, pl, taker, qtyLeft)
 		qtyLeft = qtyLeft.Sub(q)
 		qtyProcessed = qtyProcessed.Add(q)
+		orderQueue = pl.GetNextQueue(price)
 	}
 
 	return
 }
 
-func (pl *priceLevel) processLimitOrder(ob *OrderBook, compare func(price decimal.Decimal) bool, takerOrderID uint64, qty decimal.Decimal, flag FlagType) (qtyProcessed decimal.Decimal) {
+func (pl *priceLevel) processLimitOrder(ob *OrderBook, compare func(price decimal.Decimal) bool, taker *Order) (qtyProcessed decimal.Decimal) {
+	qty, flag := taker.Qty, taker.Flag
 	orderQueue := pl.GetQueue()
 	if orderQueue == nil || !compare(orderQueue.Price()) {
 		return
 	}
 
-	// TODO: Fix AoN
-	if flag&(AoN|FoK) != 0 {
-		if qty.GreaterThan(pl.Volume()) {
-			return decimal.Zero
-		}
-
-		canFill := false
-		for orderQueue != nil && compare(orderQueue.Price()) {
-			if qty.LessThanOrEqual(orderQueue.TotalQty()) {
-				canFill = true
-				break
-			}
-			qty = qty.Sub(orderQueue.TotalQty())
-			orderQueue = pl.GetNextQueue(orderQueue.Price())
-		}
-
-		if !canFill {
-			return decimal.Zero
-		}
+	if flag&(AoN|FoK) != 0 && !pl.canFill(compare, qty, ob.selfTrade(taker.Owner)) {
+		return decimal.Zero
 	}
 
-	orderQueue = pl.GetQueue()
 	qtyLeft := qty
 	qtyProcessed = decimal.Zero
-	for orderQueue := pl.GetQueue(); qtyLeft.GreaterThan(decimal.Zero) && orderQueue != nil && compare(orderQueue.Price()); orderQueue = pl.GetQueue() {
-		_, q := orderQueue.process(ob, takerOrderID, qtyLeft)
+	for orderQueue := pl.GetQueue(); qtyLeft.GreaterThan(decimal.Zero) && orderQueue != nil && compare(orderQueue.Price()); {
+		price := orderQueue.Price()
+		q := orderQueue.process(ob, pl, taker, qtyLeft)
 		qtyLeft = qtyLeft.Sub(q)
 		qtyProcessed = qtyProcessed.Add(q)
+		orderQueue = pl.GetNextQueue(price)
 	}
 
 	return
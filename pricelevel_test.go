@@ -7,7 +7,7 @@ import (
 )
 
 func TestPriceLevel(t *testing.T) {
-	ot := newPriceLevel(BidPrice)
+	ot := newPriceLevel(BidPrice, nil)
 
 	o1 := NewOrder(
 		1,
@@ -68,7 +68,7 @@ func TestPriceLevel(t *testing.T) {
 }
 
 func TestPriceFinding(t *testing.T) {
-	os := newPriceLevel(AskPrice)
+	os := newPriceLevel(AskPrice, nil)
 
 	os.Append(NewOrder(1, Limit, Sell, decimal.New(5, 0), decimal.New(130, 0), decimal.Zero, None))
 	os.Append(NewOrder(2, Limit, Sell, decimal.New(5, 0), decimal.New(170, 0), decimal.Zero, None))
@@ -100,7 +100,7 @@ func TestPriceFinding(t *testing.T) {
 }
 
 func TestStopQueuePriceFinding(t *testing.T) {
-	os := newPriceLevel(TrigPrice)
+	os := newPriceLevel(TrigPrice, nil)
 
 	os.Append(NewOrder(1, Limit, Sell, decimal.New(5, 0), decimal.New(10, 0), decimal.New(130, 0), None))
 	os.Append(NewOrder(2, Limit, Sell, decimal.New(5, 0), decimal.New(20, 0), decimal.New(170, 0), None))
@@ -130,3 +130,28 @@ func TestStopQueuePriceFinding(t *testing.T) {
 	t.Log(os.LargestLessThan(decimal.New(101, 0)))
 	t.Log(os.SmallestGreaterThan(decimal.New(169, 0)))
 }
+
+func TestFillable(t *testing.T) {
+	os := newPriceLevel(AskPrice, nil)
+
+	os.Append(NewOrder(1, Limit, Sell, decimal.New(5, 0), decimal.New(100, 0), decimal.Zero, AoN))
+	os.Append(NewOrder(2, Limit, Sell, decimal.New(2, 0), decimal.New(100, 0), decimal.Zero, None))
+	os.Append(NewOrder(3, Limit, Sell, decimal.New(3, 0), decimal.New(110, 0), decimal.Zero, None))
+
+	cases := []struct {
+		qty, limit, want uint64
+	}{
+		{qty: 3, limit: 100, want: 2},
+		{qty: 3, limit: 110, want: 3},
+		{qty: 6, limit: 100, want: 6},
+		{qty: 7, limit: 100, want: 7},
+		{qty: 12, limit: 110, want: 10},
+	}
+
+	for _, c := range cases {
+		got := os.fillable(decimal.New(c.limit, 0).GreaterThanOrEqual, decimal.New(c.qty, 0), selfTrade{})
+		if !got.Equal(decimal.New(c.want, 0)) {
+			t.Fatalf("fillable(%d @ %d) = %s, want %d", c.qty, c.limit, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package orderbook
+
+import (
+	"math/bits"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// ProRata configures pro-rata matching. The quantity an incoming order takes
+// from a price level is allocated in four steps:
+//
+//  1. With TopOrder, the first order of the level is filled as far as possible.
+//  2. FIFOPercent percent of what is left is allocated in time priority.
+//  3. The rest is allocated in proportion to the displayed quantity of each
+//     order, rounded down to a multiple of Lot. Allocations smaller than
+//     MinAlloc are dropped and the quantity left over by rounding is
+//     allocated in time priority.
+//  4. Anything still unfilled, e.g. because it could only be filled by a
+//     resting AoN order, is matched in time priority.
+//
+// A zero ProRata is plain pro-rata. Self-trades are resolved before the
+// allocation starts.
+type ProRata struct {
+	TopOrder    bool
+	FIFOPercent uint8 // 100 or more is plain FIFO
+	MinAlloc    decimal.Decimal
+	Lot         decimal.Decimal
+}
+
+// allocation is the quantity allocated to a resting order, in fixed point units
+type allocation struct {
+	o   *Order
+	qty uint64
+}
+
+// processProRata matches qty of the taker order against the queue as
+// configured by the ProRata of the book
+func (oq *orderQueue) processProRata(ob *OrderBook, pl *priceLevel, taker *Order, qty decimal.Decimal) decimal.Decimal {
+	pr := ob.proRata
+	left := qty
+
+	if ob.stpMode != STPNone && taker.Owner != 0 {
+		for ho := oq.head; ho != nil && left.GreaterThan(decimal.Zero); {
+			next := ho.next
+			if !ho.canceled && ho.Owner == taker.Owner {
+				left = left.Sub(ob.preventSelfTrade(pl, ho, taker, left))
+			}
+			ho = next
+		}
+	}
+
+	if pr.TopOrder && left.GreaterThan(decimal.Zero) {
+		if ho := oq.head; ho != nil && !ho.canceled && ho.Flag&AoN == 0 {
+			fill := ho.Visible()
+			if left.LessThan(fill) {
+				fill = left
+			}
+
+			oq.trade(ob, pl, ho, taker, fill, left)
+			left = left.Sub(fill)
+		}
+	}
+
+	if pr.FIFOPercent > 0 && left.GreaterThan(decimal.Zero) {
+		pct := uint64(min(pr.FIFOPercent, 100))
+		fifo := pr.lots(pl, mulDiv(pl.bits.of(left), pct, 100))
+		if fifo > 0 {
+			left = left.Sub(oq.processFIFO(ob, pl, taker, fromBits(fifo), left))
+		}
+	}
+
+	if left.GreaterThan(decimal.Zero) {
+		left = left.Sub(oq.allocate(ob, pl, taker, left))
+	}
+
+	if left.GreaterThan(decimal.Zero) {
+		left = left.Sub(oq.processFIFO(ob, pl, taker, left, left))
+	}
+
+	return qty.Sub(left)
+}
+
+// allocate fills up to qty of the taker order, which is also what it has left
+// to fill, in proportion to the displayed quantity of the resting orders.
+// Resting AoN orders do not take part.
+func (oq *orderQueue) allocate(ob *OrderBook, pl *priceLevel, taker *Order, qty decimal.Decimal) decimal.Decimal {
+	pr := ob.proRata
+
+	allocs := ob.allocs[:0]
+	var total uint64
+	for o := oq.head; o != nil; o = o.next {
+		if !o.canceled && o.Flag&AoN == 0 {
+			allocs = append(allocs, allocation{o: o})
+			total += pl.bits.of(o.Visible())
+		}
+	}
+	ob.allocs = allocs
+
+	if total == 0 {
+		return decimal.Zero
+	}
+
+	avail := min(pl.bits.of(qty), total)
+	minAlloc := pl.bits.of(pr.MinAlloc)
+
+	var sum uint64
+	for i := range allocs {
+		a := pr.lots(pl, mulDiv(avail, pl.bits.of(allocs[i].o.Visible()), total))
+		if a < minAlloc {
+			a = 0
+		}
+		allocs[i].qty = a
+		sum += a
+	}
+
+	// The quantity left over by rounding goes to the orders in time priority
+	for i := 0; i < len(allocs) && sum < avail; i++ {
+		extra := min(pl.bits.of(allocs[i].o.Visible())-allocs[i].qty, avail-sum)
+		allocs[i].qty += extra
+		sum += extra
+	}
+
+	left := qty
+	for _, a := range allocs {
+		if a.qty == 0 || a.o.canceled {
+			// Legs of OCO groups that fired during the allocation lose their share
+			continue
+		}
+
+		fill := fromBits(a.qty)
+		oq.trade(ob, pl, a.o, taker, fill, left)
+		left = left.Sub(fill)
+	}
+
+	return qty.Sub(left)
+}
+
+// lots rounds a quantity in fixed point units down to a multiple of the lot
+func (pr *ProRata) lots(pl *priceLevel, x uint64) uint64 {
+	lot := pl.bits.of(pr.Lot)
+	if lot == 0 {
+		return x
+	}
+	return x - x%lot
+}
+
+// mulDiv returns x*y/z rounded down. The result must fit in 64 bits.
+func mulDiv(x, y, z uint64) uint64 {
+	hi, lo := bits.Mul64(x, y)
+	q, _ := bits.Div64(hi, lo, z)
+	return q
+}
+
+// fromBits returns the decimal with fixed point value x
+func fromBits(x uint64) decimal.Decimal {
+	return decimal.NewI(x, 8)
+}
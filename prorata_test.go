@@ -0,0 +1,105 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func getProRataOrderBook(p ProRata) (*Notification, *OrderBook) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithProRata(p))
+
+	processLine(ob, "1	L	S	10	100	0	N")
+	processLine(ob, "2	L	S	30	100	0	N")
+	processLine(ob, "3	L	S	60	100	0	N")
+	n.Reset()
+
+	return n, ob
+}
+
+func TestProRata_Allocation(t *testing.T) {
+	n, ob := getProRataOrderBook(ProRata{})
+
+	processLine(ob, "4	L	B	50	100	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 4 50",
+		"1 4 FilledPartial FilledPartial 5 100",
+		"2 4 FilledPartial FilledPartial 15 100",
+		"3 4 FilledPartial FilledComplete 30 100",
+	})
+	assert.Equal(t, decimal.New(5, 0), ob.Order(1).Qty)
+}
+
+func TestProRata_LotAndMinAlloc(t *testing.T) {
+	n, ob := getProRataOrderBook(ProRata{Lot: decimal.New(2, 0), MinAlloc: decimal.New(4, 0)})
+
+	// 2.5, 7.5 and 15 are rounded to 2, 6 and 14. The 2 of order 1 is below
+	// the minimum, so the 5 left over goes to order 1 in time priority.
+	processLine(ob, "4	M	B	25	0	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 4 25",
+		"1 4 FilledPartial FilledPartial 5 100",
+		"2 4 FilledPartial FilledPartial 6 100",
+		"3 4 FilledPartial FilledComplete 14 100",
+	})
+}
+
+func TestProRata_Hybrid(t *testing.T) {
+	n, ob := getProRataOrderBook(ProRata{TopOrder: true, FIFOPercent: 40, Lot: decimal.New(1, 0)})
+
+	// The top order takes 10, FIFO 40% of the remaining 50 and the last 30
+	// are split 10:60 between orders 2 and 3
+	processLine(ob, "4	L	B	60	100	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 4 60",
+		"1 4 FilledComplete FilledPartial 10 100",
+		"2 4 FilledPartial FilledPartial 20 100",
+		"2 4 FilledPartial FilledPartial 5 100",
+		"3 4 FilledPartial FilledComplete 25 100",
+	})
+	assert.Nil(t, ob.Order(1))
+	assert.Equal(t, decimal.New(5, 0), ob.Order(2).Qty)
+	assert.Equal(t, decimal.New(35, 0), ob.Order(3).Qty)
+}
+
+func TestProRata_AoNAndLevels(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithProRata(ProRata{}))
+	processLine(ob, "1	L	S	4	100	0	A")
+	processLine(ob, "2	L	S	6	100	0	N")
+	processLine(ob, "3	L	S	10	110	0	N")
+	processLine(ob, "4	L	S	10	110	0	N")
+	n.Reset()
+
+	// The AoN order takes no part in the allocation but fills the remainder
+	processLine(ob, "5	L	B	16	110	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 5 16",
+		"2 5 FilledComplete FilledPartial 6 100",
+		"1 5 FilledComplete FilledPartial 4 100",
+		"3 5 FilledPartial FilledPartial 3 110",
+		"4 5 FilledPartial FilledComplete 3 110",
+	})
+}
+
+func TestProRata_SelfTrade(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithProRata(ProRata{}), WithSelfTradePrevention(STPCancelOldest))
+	addOwnedOrder(ob, 1, Sell, 10, 100, 7)
+	addOwnedOrder(ob, 2, Sell, 10, 100, 8)
+	addOwnedOrder(ob, 3, Sell, 30, 100, 9)
+	n.Reset()
+
+	addOwnedOrder(ob, 4, Buy, 8, 100, 7)
+	n.Verify(t, []string{
+		"CreateOrder Accepted 4 8",
+		"SelfTrade Canceled 1 10 ErrSelfTrade",
+		"2 4 FilledPartial FilledPartial 2 100",
+		"3 4 FilledPartial FilledComplete 6 100",
+	})
+}
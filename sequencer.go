@@ -0,0 +1,251 @@
+package orderbook
+
+import (
+	"runtime"
+
+	"github.com/geseq/orderbook/pkg/pool"
+	decimal "github.com/geseq/udecimal"
+)
+
+// CommandType is the type of a command submitted to a Sequencer
+type CommandType byte
+
+const (
+	// CmdAddOrder calls OrderBook.AddOrderWithAttrs
+	CmdAddOrder CommandType = iota + 1
+	// CmdCancelOrder calls OrderBook.CancelOrder
+	CmdCancelOrder
+	// CmdModifyOrder calls OrderBook.ModifyOrder
+	CmdModifyOrder
+	// CmdAdvanceTime calls OrderBook.AdvanceTime
+	CmdAdvanceTime
+	// CmdUncross calls OrderBook.Uncross
+	CmdUncross
+	// CmdSetState calls OrderBook.SetState. A refused change is reported to
+	// the StateHandler with the error set.
+	CmdSetState
+	// CmdSetReferencePrice calls OrderBook.SetReferencePrice
+	CmdSetReferencePrice
+
+	cmdStop
+)
+
+// Command is a call to the order book submitted to a Sequencer. Only the
+// fields used by the command type need to be set; Qty and Price are the new
+// quantity and price of CmdModifyOrder and Price is the reference price of
+// CmdSetReferencePrice.
+type Command struct {
+	Type      CommandType
+	OrderID   uint64
+	Class     ClassType
+	Side      SideType
+	Qty       decimal.Decimal
+	Price     decimal.Decimal
+	TrigPrice decimal.Decimal
+	Flag      FlagType
+	Attrs     OrderAttrs
+	Now       int64
+	State     SessionState
+}
+
+// Sequencer drives an order book from a single goroutine in the style of the
+// LMAX Disruptor.
+//
+// Commands from any number of producer goroutines are written in place into a
+// preallocated ingress ring. The matching goroutine, locked to its OS thread,
+// reads them in ring order, assigns each the next token of the book and
+// applies it. The events and market data of the book are copied into an
+// egress ring and delivered to the handlers on a goroutine of their own, so
+// that handler I/O never runs on the matching thread.
+type Sequencer struct {
+	ob      *OrderBook
+	in      *pool.ItemChanV2[Command]
+	out     *pool.ItemChanV2[egressEvent]
+	handler EventHandler
+	md      MarketDataHandler
+	done    chan struct{}
+}
+
+// egressEvent is an event of the book waiting to be delivered to the handler
+type egressEvent struct {
+	kind   egressKind
+	order  OrderEvent
+	trade  TradeEvent
+	state  StateEvent
+	update marketDataUpdate
+}
+
+// marketDataUpdate holds the arguments of a MarketDataHandler call
+type marketDataUpdate struct {
+	seq     uint64
+	action  UpdateAction
+	side    SideType
+	orderID uint64
+	price   decimal.Decimal
+	qty     decimal.Decimal
+	orders  uint64
+}
+
+type egressKind byte
+
+const (
+	egressOrder egressKind = iota
+	egressTrade
+	egressState
+	egressLevel
+	egressOrderUpdate
+	egressStop
+)
+
+// NewSequencer creates a sequencer that drives ob with rings of size entries
+// and delivers the events of ob to h. If h is also a StateHandler it receives
+// the session state changes of ob as well. The market data of ob, if it has a
+// MarketDataHandler, is delivered through the egress ring too. The sequencer
+// takes over the event delivery of ob, which must not be called directly while
+// it is running.
+func NewSequencer(ob *OrderBook, h EventHandler, size uint64) *Sequencer {
+	s := &Sequencer{
+		ob:      ob,
+		in:      pool.NewItemChanV2[Command](size),
+		out:     pool.NewItemChanV2[egressEvent](size),
+		handler: h,
+		done:    make(chan struct{}),
+	}
+	ob.events = sequencerEvents{s}
+	if _, ok := h.(StateHandler); ok {
+		ob.states = sequencerEvents{s}
+	}
+	if ob.md != nil {
+		s.md = ob.md.handler
+		ob.md.handler = sequencerEvents{s}
+	}
+
+	return s
+}
+
+// Start starts the matching and egress goroutines
+func (s *Sequencer) Start() {
+	go s.match()
+	go s.deliver()
+}
+
+// Stop waits until every command submitted before it was applied and every
+// resulting event was delivered, then stops the sequencer
+func (s *Sequencer) Stop() {
+	s.in.PutWith(func(c *Command) { c.Type = cmdStop })
+	<-s.done
+}
+
+// Submit copies cmd into the ingress ring, waiting if the ring is full. It is
+// safe to call from many goroutines.
+func (s *Sequencer) Submit(cmd *Command) {
+	s.in.PutWith(func(c *Command) { *c = *cmd })
+}
+
+func (s *Sequencer) match() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ob := s.ob
+	for {
+		c := s.in.Read()
+		tok := ob.lastToken + 1
+
+		switch c.Type {
+		case CmdAddOrder:
+			ob.AddOrderWithAttrs(tok, c.OrderID, c.Class, c.Side, c.Qty, c.Price, c.TrigPrice, c.Flag, c.Attrs)
+		case CmdCancelOrder:
+			ob.CancelOrder(tok, c.OrderID)
+		case CmdModifyOrder:
+			ob.ModifyOrder(tok, c.OrderID, c.Qty, c.Price)
+		case CmdAdvanceTime:
+			ob.AdvanceTime(tok, c.Now)
+		case CmdUncross:
+			ob.Uncross(tok)
+		case CmdSetState:
+			if err := ob.SetState(tok, c.State); err != nil {
+				s.rejectState(c.State, err)
+			}
+		case CmdSetReferencePrice:
+			ob.SetReferencePrice(tok, c.Price)
+		case cmdStop:
+			s.out.PutWith(func(e *egressEvent) { e.kind = egressStop })
+			return
+		}
+	}
+}
+
+// rejectState reports a session state change the book refused, if the
+// handler receives state changes
+func (s *Sequencer) rejectState(state SessionState, err error) {
+	ob := s.ob
+	if ob.states == nil {
+		return
+	}
+	ob.stateEvent = StateEvent{Version: EventVersion, From: ob.state, To: state, Time: ob.now, Err: err}
+	ob.states.OnStateChange(&ob.stateEvent)
+}
+
+func (s *Sequencer) deliver() {
+	for {
+		e := s.out.Read()
+
+		switch e.kind {
+		case egressOrder:
+			s.handler.OnOrderEvent(&e.order)
+		case egressTrade:
+			s.handler.OnTradeEvent(&e.trade)
+		case egressState:
+			s.handler.(StateHandler).OnStateChange(&e.state)
+		case egressLevel:
+			u := &e.update
+			s.md.PutLevel(u.seq, u.action, u.side, u.price, u.qty, u.orders)
+		case egressOrderUpdate:
+			u := &e.update
+			s.md.PutOrderUpdate(u.seq, u.action, u.side, u.orderID, u.price, u.qty)
+		case egressStop:
+			close(s.done)
+			return
+		}
+	}
+}
+
+// sequencerEvents copies the events of the book into the egress ring
+type sequencerEvents struct {
+	s *Sequencer
+}
+
+func (h sequencerEvents) OnOrderEvent(e *OrderEvent) {
+	h.s.out.PutWith(func(o *egressEvent) {
+		o.kind = egressOrder
+		o.order = *e
+	})
+}
+
+func (h sequencerEvents) OnTradeEvent(e *TradeEvent) {
+	h.s.out.PutWith(func(o *egressEvent) {
+		o.kind = egressTrade
+		o.trade = *e
+	})
+}
+
+func (h sequencerEvents) OnStateChange(e *StateEvent) {
+	h.s.out.PutWith(func(o *egressEvent) {
+		o.kind = egressState
+		o.state = *e
+	})
+}
+
+func (h sequencerEvents) PutLevel(seq uint64, action UpdateAction, side SideType, price, qty decimal.Decimal, orders uint64) {
+	h.s.out.PutWith(func(o *egressEvent) {
+		o.kind = egressLevel
+		o.update = marketDataUpdate{seq: seq, action: action, side: side, price: price, qty: qty, orders: orders}
+	})
+}
+
+func (h sequencerEvents) PutOrderUpdate(seq uint64, action UpdateAction, side SideType, orderID uint64, price, qty decimal.Decimal) {
+	h.s.out.PutWith(func(o *egressEvent) {
+		o.kind = egressOrderUpdate
+		o.update = marketDataUpdate{seq: seq, action: action, side: side, orderID: orderID, price: price, qty: qty}
+	})
+}
@@ -0,0 +1,128 @@
+package orderbook
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencer_Producers(t *testing.T) {
+	var journal bytes.Buffer
+	j := NewJournal(&journal)
+	ob := NewOrderBook(&EmptyNotification{}, WithJournal(j))
+
+	n := &Notification{}
+	s := NewSequencer(ob, NewNotificationAdapter(n), 16)
+	s.Start()
+
+	const producers, perProducer = 4, 200
+
+	var wg sync.WaitGroup
+	for p := uint64(0); p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cmd := Command{Type: CmdAddOrder, Class: Limit, Qty: decimal.New(1, 0)}
+			for i := uint64(0); i < perProducer; i++ {
+				cmd.OrderID = p*perProducer + i + 1
+				cmd.Side = Buy
+				cmd.Price = decimal.New(90+i%10, 0)
+				if p%2 == 1 {
+					cmd.Side = Sell
+					cmd.Price = decimal.New(95+i%10, 0)
+				}
+				s.Submit(&cmd)
+			}
+
+			s.Submit(&Command{Type: CmdCancelOrder, OrderID: p*perProducer + 1})
+		}()
+	}
+	wg.Wait()
+	s.Stop()
+
+	// Every command got a token of its own
+	assert.Equal(t, uint64(producers*(perProducer+1)), ob.lastToken)
+
+	// The events delivered by the egress goroutine are those of a book that is
+	// fed the same commands directly
+	require.NoError(t, j.Flush())
+	rn := &Notification{}
+	require.NoError(t, Replay(&journal, NewOrderBook(rn)))
+	assert.Equal(t, rn.Strings(), n.Strings())
+}
+
+func TestSequencer_StopDrains(t *testing.T) {
+	ob := NewOrderBook(&EmptyNotification{})
+	n := &Notification{}
+	s := NewSequencer(ob, NewNotificationAdapter(n), 2)
+	s.Start()
+
+	s.Submit(&Command{Type: CmdAddOrder, OrderID: 1, Class: Limit, Side: Sell, Qty: decimal.New(2, 0), Price: decimal.New(100, 0)})
+	s.Submit(&Command{Type: CmdModifyOrder, OrderID: 1, Qty: decimal.New(1, 0), Price: decimal.New(100, 0)})
+	s.Submit(&Command{Type: CmdAddOrder, OrderID: 2, Class: Market, Side: Buy, Qty: decimal.New(1, 0)})
+	s.Submit(&Command{Type: CmdAdvanceTime, Now: 10})
+	s.Stop()
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"ModifyOrder Accepted 1 1",
+		"CreateOrder Accepted 2 1",
+		"1 2 FilledComplete FilledComplete 1 100",
+	})
+	assert.Equal(t, int64(10), ob.now)
+}
+
+func TestSequencer_StateChanges(t *testing.T) {
+	ob := NewOrderBook(&EmptyNotification{})
+	n := &Notification{}
+	sn := &stateNotification{}
+	h := struct {
+		EventHandler
+		StateHandler
+	}{NewNotificationAdapter(n), sn}
+
+	s := NewSequencer(ob, h, 4)
+	s.Start()
+
+	s.Submit(&Command{Type: CmdSetState, State: Halted})
+	s.Submit(&Command{Type: CmdAddOrder, OrderID: 1, Class: Limit, Side: Sell, Qty: decimal.New(1, 0), Price: decimal.New(100, 0)})
+	s.Submit(&Command{Type: CmdSetState, State: Continuous})
+	s.Submit(&Command{Type: CmdSetState, State: PostClose})
+	s.Stop()
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 1 1 ErrSessionState",
+	})
+	assert.Equal(t, []string{
+		"Continuous Halted 0",
+		"Halted Continuous 0",
+		"Continuous PostClose 0 " + ErrStateTransition.Error(),
+	}, sn.changes)
+}
+
+func TestSequencer_MarketData(t *testing.T) {
+	md := &mdRecorder{}
+	ob := NewOrderBook(&EmptyNotification{}, WithMarketDataHandler(md))
+	s := NewSequencer(ob, NewNotificationAdapter(&EmptyNotification{}), 4)
+
+	// The handler of the book now feeds the egress ring
+	_, direct := ob.md.handler.(*mdRecorder)
+	assert.False(t, direct)
+
+	s.Start()
+	s.Submit(&Command{Type: CmdAddOrder, OrderID: 1, Class: Limit, Side: Sell, Qty: decimal.New(2, 0), Price: decimal.New(100, 0)})
+	s.Submit(&Command{Type: CmdAddOrder, OrderID: 2, Class: Market, Side: Buy, Qty: decimal.New(1, 0)})
+	s.Stop()
+
+	assert.Equal(t, []string{
+		"O Add sell 1 100 2",
+		"L Add sell 100 2 1",
+		"O Change sell 1 100 1",
+		"L Change sell 100 1 1",
+	}, md.events)
+}
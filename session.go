@@ -0,0 +1,183 @@
+package orderbook
+
+import (
+	"sync/atomic"
+)
+
+// SessionState is the trading session state of an order book
+type SessionState byte
+
+const (
+	// Continuous matches orders as they arrive. It is the state of a new book.
+	Continuous SessionState = iota
+	// PreOpen collects limit orders without matching
+	PreOpen
+	// OpeningAuction collects limit and market orders without matching. The
+	// book is uncrossed when it moves on to a state that matches.
+	OpeningAuction
+	// Halted accepts cancellations only
+	Halted
+	// ClosingAuction collects limit and market orders without matching. The
+	// book is uncrossed when it moves on to Closed.
+	ClosingAuction
+	// Closed accepts cancellations only
+	Closed
+	// PostClose collects limit orders without matching for the next session
+	PostClose
+	// VolatilityAuction collects limit and market orders without matching
+	// after the circuit breaker tripped. The book is uncrossed when it moves
+	// on to a state that matches.
+	VolatilityAuction
+)
+
+// String implements fmt.Stringer interface
+func (s SessionState) String() string {
+	switch s {
+	case Continuous:
+		return "Continuous"
+	case PreOpen:
+		return "PreOpen"
+	case OpeningAuction:
+		return "OpeningAuction"
+	case Halted:
+		return "Halted"
+	case ClosingAuction:
+		return "ClosingAuction"
+	case Closed:
+		return "Closed"
+	case PostClose:
+		return "PostClose"
+	case VolatilityAuction:
+		return "VolatilityAuction"
+	default:
+		return ""
+	}
+}
+
+// sessionTransitions lists the states each state can move to
+var sessionTransitions = [...][]SessionState{
+	Continuous:        {Halted, ClosingAuction, Closed, VolatilityAuction},
+	PreOpen:           {OpeningAuction, Halted, Closed},
+	OpeningAuction:    {Continuous, Halted, Closed},
+	Halted:            {Continuous, OpeningAuction, Closed},
+	ClosingAuction:    {Closed, Halted},
+	Closed:            {PostClose, PreOpen},
+	PostClose:         {PreOpen, Closed},
+	VolatilityAuction: {Continuous, Halted, Closed},
+}
+
+// canMoveTo reports whether a book in state s can move to state to
+func (s SessionState) canMoveTo(to SessionState) bool {
+	if int(s) >= len(sessionTransitions) {
+		return false
+	}
+
+	for _, t := range sessionTransitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// collects reports whether orders rest without matching in state s
+func (s SessionState) collects() bool {
+	switch s {
+	case PreOpen, OpeningAuction, ClosingAuction, PostClose, VolatilityAuction:
+		return true
+	default:
+		return false
+	}
+}
+
+// auction reports whether state s is an auction that ends in an uncross
+func (s SessionState) auction() bool {
+	switch s {
+	case OpeningAuction, ClosingAuction, VolatilityAuction:
+		return true
+	default:
+		return false
+	}
+}
+
+// accepts reports whether new orders of class with flag are accepted in
+// state s. Orders that cannot rest are not accepted while orders are being
+// collected and market orders only during the auctions.
+func (s SessionState) accepts(class ClassType, flag FlagType) bool {
+	switch s {
+	case Continuous:
+		return true
+	case OpeningAuction, ClosingAuction, VolatilityAuction:
+		return flag&(IoC|FoK|AoN) == 0
+	case PreOpen, PostClose:
+		return class == Limit && flag&(IoC|FoK|AoN) == 0
+	default:
+		return false
+	}
+}
+
+// StateHandler receives the session state changes of an order book
+type StateHandler interface {
+	OnStateChange(e *StateEvent)
+}
+
+// StateEvent reports a change of the session state of a book. Err is set if
+// a Sequencer was asked for a change the book refused; the state is then
+// still From.
+type StateEvent struct {
+	Version uint8        `json:"version" `
+	From    SessionState `json:"from" `
+	To      SessionState `json:"to" `
+	Time    int64        `json:"time" ` // sequencer time of the change
+	Err     error        `json:"-" `
+}
+
+// State returns the session state of the book
+func (ob *OrderBook) State() SessionState {
+	return ob.state
+}
+
+// SetState moves the book to another session state and reports the change to
+// the StateHandler of the book.
+//
+// Orders are collected without matching in PreOpen, PostClose and the
+// auctions. Leaving OpeningAuction, ClosingAuction or VolatilityAuction for
+// Continuous or Closed, or resuming Continuous after a halt, uncrosses the
+// book at its equilibrium price; orders collected in PreOpen and PostClose are
+// left untouched. Resting orders are kept across all states; only
+// cancellations are accepted while Halted or Closed.
+//
+// SetState returns ErrStateTransition and leaves the book unchanged if the
+// book cannot move from its current state to state. The token is consumed
+// either way.
+func (ob *OrderBook) SetState(tok uint64, state SessionState) error {
+	if !atomic.CompareAndSwapUint64(&ob.lastToken, tok-1, tok) {
+		panic("invalid token received: cannot maintain determinism")
+	}
+	if ob.journal != nil {
+		ob.journal.setState(tok, state)
+	}
+
+	from := ob.state
+	if !from.canMoveTo(state) {
+		return ErrStateTransition
+	}
+
+	ob.collar.tripped = false
+	if state == Continuous || from.auction() && state == Closed {
+		ob.uncross(state)
+	} else {
+		ob.changeState(state)
+	}
+	return nil
+}
+
+// changeState sets the session state and reports the change
+func (ob *OrderBook) changeState(state SessionState) {
+	from := ob.state
+	ob.state = state
+	if ob.states != nil {
+		ob.stateEvent = StateEvent{Version: EventVersion, From: from, To: state, Time: ob.now}
+		ob.states.OnStateChange(&ob.stateEvent)
+	}
+}
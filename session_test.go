@@ -0,0 +1,240 @@
+package orderbook
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stateNotification struct {
+	changes []string
+}
+
+func (s *stateNotification) OnStateChange(e *StateEvent) {
+	c := fmt.Sprintf("%s %s %d", e.From, e.To, e.Time)
+	if e.Err != nil {
+		c += " " + e.Err.Error()
+	}
+	s.changes = append(s.changes, c)
+}
+
+func setState(ob *OrderBook, state SessionState) error {
+	err := ob.SetState(tok, state)
+	tok++
+	return err
+}
+
+func TestSessionState_Day(t *testing.T) {
+	tok = 1
+	n := &Notification{}
+	sn := &stateNotification{}
+	ob := NewOrderBook(n, WithStateHandler(sn))
+	assert.Equal(t, Continuous, ob.State())
+
+	require.NoError(t, setState(ob, Closed))
+	require.NoError(t, setState(ob, PreOpen))
+	processLine(ob, "1	L	B	2	100	0	N")
+
+	advanceTime(ob, at(8, 0))
+	require.NoError(t, setState(ob, OpeningAuction))
+	processLine(ob, "2	M	B	1	0	0	N")
+	processLine(ob, "3	L	S	2	95	0	N")
+	processLine(ob, "4	M	S	1	0	0	N")
+
+	// Moving to continuous trading uncrosses the book
+	n.Reset()
+	advanceTime(ob, at(9, 0))
+	require.NoError(t, setState(ob, Continuous))
+	n.Verify(t, []string{
+		"2 4 FilledComplete FilledComplete 1 95",
+		"1 3 FilledComplete FilledComplete 2 95",
+	})
+	assert.Equal(t, Continuous, ob.State())
+
+	processLine(ob, "5	L	B	1	90	0	N")
+	processLine(ob, "6	M	S	1	0	0	N")
+	require.NoError(t, setState(ob, ClosingAuction))
+	require.NoError(t, setState(ob, Closed))
+	require.NoError(t, setState(ob, PostClose))
+
+	assert.Equal(t, []string{
+		"Continuous Closed 0",
+		"Closed PreOpen 0",
+		fmt.Sprintf("PreOpen OpeningAuction %d", at(8, 0)),
+		fmt.Sprintf("OpeningAuction Continuous %d", at(9, 0)),
+		fmt.Sprintf("Continuous ClosingAuction %d", at(9, 0)),
+		fmt.Sprintf("ClosingAuction Closed %d", at(9, 0)),
+		fmt.Sprintf("Closed PostClose %d", at(9, 0)),
+	}, sn.changes)
+}
+
+func TestSessionState_Orders(t *testing.T) {
+	tests := []struct {
+		state    SessionState
+		expected []string
+	}{
+		{Continuous, []string{
+			"CreateOrder Accepted 1 1",
+			"CreateOrder Accepted 2 1",
+			"CreateOrder Accepted 3 1",
+			"2 3 FilledComplete FilledComplete 1 110",
+			"CreateOrder Accepted 4 1",
+			"CreateOrder Canceled 4 1",
+		}},
+		{PreOpen, []string{
+			"CreateOrder Accepted 1 1",
+			"CreateOrder Accepted 2 1",
+			"CreateOrder Rejected 3 1 ErrSessionState",
+			"CreateOrder Rejected 4 1 ErrSessionState",
+		}},
+		{OpeningAuction, []string{
+			"CreateOrder Accepted 1 1",
+			"CreateOrder Accepted 2 1",
+			"CreateOrder Accepted 3 1",
+			"CreateOrder Rejected 4 1 ErrSessionState",
+		}},
+		{Halted, []string{
+			"CreateOrder Rejected 1 1 ErrSessionState",
+			"CreateOrder Rejected 2 1 ErrSessionState",
+			"CreateOrder Rejected 3 1 ErrSessionState",
+			"CreateOrder Rejected 4 1 ErrSessionState",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state.String(), func(t *testing.T) {
+			n, ob := getTestOrderBook()
+			ob.state = tt.state
+
+			processLine(ob, "1	L	B	1	100	0	N")
+			processLine(ob, "2	L	S	1	110	0	N")
+			processLine(ob, "3	M	B	1	0	0	N")
+			processLine(ob, "4	L	S	1	120	0	I")
+
+			n.Verify(t, tt.expected)
+		})
+	}
+}
+
+func TestSessionState_Halted(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	require.NoError(t, setState(ob, Halted))
+
+	n.Reset()
+	processLine(ob, "11	M	B	1	0	0	N")
+	ob.ModifyOrder(tok, 6, decimal.New(1, 0), decimal.New(100, 0))
+	tok++
+	ob.CancelOrder(tok, 6)
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 11 1 ErrSessionState",
+		"ModifyOrder Rejected 6 1 ErrSessionState",
+		"CancelOrder Canceled 6 2",
+	})
+
+	// A halt during continuous trading resumes without an uncross
+	n.Reset()
+	require.NoError(t, setState(ob, Continuous))
+	processLine(ob, "11	M	B	1	0	0	N")
+	n.Verify(t, []string{
+		"CreateOrder Accepted 11 1",
+		"7 11 FilledPartial FilledComplete 1 110",
+	})
+}
+
+func TestSessionState_CollectedOrdersKept(t *testing.T) {
+	n, ob := getTestOrderBook()
+	require.NoError(t, setState(ob, Closed))
+	require.NoError(t, setState(ob, PreOpen))
+	processLine(ob, "1	L	B	1	100	0	N")
+	processLine(ob, "2	L	S	1	90	0	N")
+
+	// Closing from PreOpen or PostClose does not uncross the book
+	n.Reset()
+	require.NoError(t, setState(ob, Closed))
+	require.NoError(t, setState(ob, PostClose))
+	require.NoError(t, setState(ob, Closed))
+	n.Verify(t, []string{})
+	assert.NotNil(t, ob.Order(1))
+	assert.NotNil(t, ob.Order(2))
+
+	require.NoError(t, setState(ob, PreOpen))
+	require.NoError(t, setState(ob, OpeningAuction))
+	n.Reset()
+	uncross(ob)
+	n.Verify(t, []string{
+		"1 2 FilledComplete FilledComplete 1 90",
+	})
+	assert.Equal(t, Continuous, ob.State())
+}
+
+func TestSessionState_ClosingAuctionStops(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	1	100	0	N")
+	processLine(ob, "2	L	S	1	100	0	N")
+	processLine(ob, "3	M	S	1	0	95	SL")
+	processLine(ob, "4	L	S	1	90	95	SL")
+	processLine(ob, "5	L	B	5	80	0	N")
+
+	require.NoError(t, setState(ob, ClosingAuction))
+	processLine(ob, "6	L	B	1	95	0	N")
+	processLine(ob, "7	L	S	1	95	0	N")
+
+	// Stops triggered by the closing uncross do not match in the Closed book
+	n.Reset()
+	require.NoError(t, setState(ob, Closed))
+	n.Verify(t, []string{
+		"6 7 FilledComplete FilledComplete 1 95",
+		"CreateOrder Triggered 3 1",
+		"CreateOrder Triggered 4 1",
+		"CancelOrder Canceled 3 1",
+	})
+	assert.Equal(t, Closed, ob.State())
+	assert.Equal(t, decimal.New(90, 0), ob.asks.MinPriceQueue().Price())
+	assert.Equal(t, decimal.New(5, 0), ob.Order(5).Qty)
+}
+
+func TestSessionState_InvalidTransition(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	assert.Equal(t, ErrStateTransition, setState(ob, PreOpen))
+	assert.Equal(t, ErrStateTransition, setState(ob, Continuous))
+	assert.Equal(t, Continuous, ob.State())
+	assert.Equal(t, uint64(2), ob.lastToken)
+	n.Verify(t, []string{})
+}
+
+func TestSessionState_SnapshotAndJournal(t *testing.T) {
+	var journal, snap bytes.Buffer
+	j := NewJournal(&journal)
+
+	tok = 1
+	n := &Notification{}
+	ob := NewOrderBook(n, WithJournal(j))
+	setState(ob, Closed)
+	setState(ob, PreOpen)
+	processLine(ob, "1	L	B	2	100	0	N")
+	processLine(ob, "2	L	S	1	90	0	N")
+	setState(ob, OpeningAuction)
+	require.NoError(t, ob.Snapshot(&snap))
+
+	rob, err := RestoreOrderBook(&snap, &Notification{})
+	require.NoError(t, err)
+	assert.Equal(t, OpeningAuction, rob.State())
+
+	setState(ob, Continuous)
+	require.NoError(t, j.Flush())
+
+	rn := &Notification{}
+	rob = NewOrderBook(rn)
+	require.NoError(t, Replay(&journal, rob))
+	assert.Equal(t, Continuous, rob.State())
+	assert.Equal(t, n.Strings(), rn.Strings())
+	assert.Equal(t, ob.StateHash(), rob.StateHash())
+}
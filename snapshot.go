@@ -0,0 +1,272 @@
+package orderbook
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	decimal "github.com/geseq/udecimal"
+)
+
+// snapshotMagic identifies an order book snapshot stream
+var snapshotMagic = [4]byte{'O', 'B', 'S', 'S'}
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion byte = 14
+
+// Snapshot writes the full state of the order book to w so that it can be
+// restored later with RestoreOrderBook.
+//
+// The snapshot contains the last token, last traded price, clock, market data
+// sequence number, last trade ID, session state, circuit breaker state and
+// reference price of the static band followed by the bids, asks, triggerOver
+// and triggerUnder price levels, the market orders resting in an auction and
+// the held exits of bracket orders. Orders
+// within each level are written in ascending price order and, within a price,
+// in queue order so that time priority is preserved exactly on restore.
+//
+// Snapshot does not consume a token and must not be called concurrently with
+// any other method of the order book.
+func (ob *OrderBook) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.Write(snapshotMagic[:])
+	bw.WriteByte(snapshotVersion)
+	writeUvarint(bw, ob.lastToken)
+	ob.lastPrice.WriteTo(bw)
+	writeVarint(bw, ob.now)
+	writeUvarint(bw, ob.mdSeq())
+	writeUvarint(bw, ob.tradeID)
+	bw.WriteByte(byte(ob.state))
+	bw.WriteByte(boolByte(ob.collar.tripped))
+	writeUvarint(bw, ob.collar.untilToken)
+	writeVarint(bw, ob.collar.untilTime)
+	ob.collar.reference.WriteTo(bw)
+
+	for _, pl := range ob.snapshotLevels() {
+		writeLevel(bw, pl)
+	}
+
+	var markets []*Order
+	for _, q := range []*orderQueue{&ob.marketBids, &ob.marketAsks} {
+		for o := q.Head(); o != nil; o = o.next {
+			markets = append(markets, o)
+		}
+	}
+	writeOrders(bw, markets)
+
+	var held []*Order
+	for it := ob.held.Iterator(); it.Next(); {
+		held = append(held, it.Value()...)
+	}
+	writeOrders(bw, held)
+
+	return bw.Flush()
+}
+
+// RestoreOrderBook creates a new order book from a snapshot written by
+// Snapshot. The options are applied exactly as they would be by NewOrderBook.
+// The next token accepted by the restored book is the one following the last
+// token recorded in the snapshot.
+func RestoreOrderBook(r io.Reader, n NotificationHandler, opts ...Option) (*OrderBook, error) {
+	br := bufio.NewReader(r)
+
+	var hdr [5]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	if [4]byte(hdr[:4]) != snapshotMagic || hdr[4] != snapshotVersion {
+		return nil, ErrInvalidSnapshot
+	}
+
+	ob := NewOrderBook(n, opts...)
+
+	lastToken, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	lastPrice, err := decimal.ReadFrom(br)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	mdSeq, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	tradeID, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	tripped, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	untilToken, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	untilTime, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	reference, err := decimal.ReadFrom(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restored orders are not published to the market data feed
+	ob.bids.md, ob.asks.md = nil, nil
+
+	for _, pl := range ob.snapshotLevels() {
+		idx := ob.orders
+		if pl.priceType == TrigPrice {
+			idx = ob.trigOrders
+		}
+
+		if err := ob.readLevel(br, pl, idx); err != nil {
+			return nil, err
+		}
+	}
+
+	err = ob.readOrders(br, func(o *Order) {
+		ob.restAuction(o)
+		ob.joinGroup(o)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ob.readOrders(br, ob.hold); err != nil {
+		return nil, err
+	}
+
+	ob.lastToken = lastToken
+	ob.lastPrice = lastPrice
+	ob.now = now
+	ob.tradeID = tradeID
+	ob.state = SessionState(state)
+	ob.collar.tripped = tripped != 0
+	ob.collar.untilToken = untilToken
+	ob.collar.untilTime = untilTime
+	ob.collar.reference = reference
+	ob.bids.md, ob.asks.md = ob.md, ob.md
+	if ob.md != nil {
+		ob.md.seq = mdSeq
+	}
+
+	return ob, nil
+}
+
+// mdSeq returns the sequence number of the last market data event
+func (ob *OrderBook) mdSeq() uint64 {
+	if ob.md == nil {
+		return 0
+	}
+	return ob.md.seq
+}
+
+// snapshotLevels returns the price levels in the order they are snapshotted
+func (ob *OrderBook) snapshotLevels() []*priceLevel {
+	return []*priceLevel{ob.bids, ob.asks, ob.triggerOver, ob.triggerUnder}
+}
+
+// writeLevel writes every order of the price level as a length prefixed
+// Compose record. Write errors are sticky in bufio.Writer and surface on Flush.
+func writeLevel(bw *bufio.Writer, pl *priceLevel) {
+	writeOrders(bw, pl.Orders())
+}
+
+// writeOrders writes orders as a count followed by length prefixed Compose
+// records
+func writeOrders(bw *bufio.Writer, orders []*Order) {
+	writeUvarint(bw, uint64(len(orders)))
+	for _, o := range orders {
+		b := o.Compose()
+		writeUvarint(bw, uint64(len(b)))
+		bw.Write(b)
+	}
+}
+
+// readLevel appends the orders of a level written by writeLevel to pl and
+// indexes them in idx
+func (ob *OrderBook) readLevel(br *bufio.Reader, pl *priceLevel, idx *orderIndex) error {
+	return ob.readOrders(br, func(o *Order) {
+		idx.put(o.ID, pl.Append(o))
+		ob.trackExpiry(o)
+		ob.joinGroup(o)
+	})
+}
+
+// readOrders reads orders written by writeOrders and passes each to add
+func (ob *OrderBook) readOrders(br *bufio.Reader, add func(o *Order)) error {
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for i := uint64(0); i < count; i++ {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		if size > maxFrameSize {
+			return ErrInvalidSnapshot
+		}
+
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return err
+		}
+
+		o := ob.pools.getOrder()
+		if err := o.Decompose(buf); err != nil {
+			return err
+		}
+
+		add(o)
+	}
+
+	return nil
+}
+
+func writeUvarint(bw *bufio.Writer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	bw.Write(b[:n])
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeVarint(bw *bufio.Writer, x int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], x)
+	bw.Write(b[:n])
+}
@@ -0,0 +1,88 @@
+package orderbook
+
+import (
+	"bytes"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot_RestoreIdentical(t *testing.T) {
+	n, ob := getTestOrderBook()
+	addDepth(ob, 0)
+	addDepth(ob, 1)
+	processLine(ob, "100	M	B	1	0	0	N") // @ LP 100
+	processLine(ob, "103	M	B	1	0	150	TP")
+	addIceberg(ob, 104, Buy, 10, 3, 95)
+	processLine(ob, "105	L	S	4	95	0	N") // @ LP 95
+	processLine(ob, "101	L	S	1	90	90	SL")
+	processLine(ob, "102	L	B	1	120	130	SL")
+	n.Reset()
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+	snap := buf.Bytes()
+
+	rn := &Notification{}
+	rob, err := RestoreOrderBook(bytes.NewReader(snap), rn)
+	require.NoError(t, err)
+
+	assert.Equal(t, ob.lastToken, rob.lastToken)
+	assert.Equal(t, ob.lastPrice, rob.lastPrice)
+	assert.Equal(t, ob.bids.Len(), rob.bids.Len())
+	assert.Equal(t, ob.asks.Len(), rob.asks.Len())
+	assert.Equal(t, ob.asks.Volume(), rob.asks.Volume())
+	assert.Equal(t, ob.asks.VisibleVolume(), rob.asks.VisibleVolume())
+	assert.Equal(t, ob.triggerOver.Len(), rob.triggerOver.Len())
+	assert.Equal(t, ob.triggerUnder.Len(), rob.triggerUnder.Len())
+	require.NotNil(t, rob.Order(101))
+	require.NotNil(t, rob.Order(16))
+
+	var rbuf bytes.Buffer
+	require.NoError(t, rob.Snapshot(&rbuf))
+	assert.Equal(t, snap, rbuf.Bytes())
+
+	// Both books must behave identically after the restore
+	next := []string{
+		"200	M	B	5	0	0	N",
+		"201	M	S	6	0	0	N",
+		"202	L	B	3	115	0	N",
+	}
+	for _, line := range next {
+		processLine(ob, line)
+		tok--
+		processLine(rob, line)
+	}
+
+	require.NotEmpty(t, n.Strings())
+	assert.Equal(t, n.Strings(), rn.Strings())
+}
+
+func TestSnapshot_Empty(t *testing.T) {
+	_, ob := getTestOrderBook()
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	rob, err := RestoreOrderBook(&buf, &EmptyNotification{})
+	require.NoError(t, err)
+	assert.Nil(t, rob.Ask(1))
+	assert.Nil(t, rob.Bid(2))
+	assert.True(t, rob.lastPrice.Equal(decimal.Zero))
+}
+
+func TestSnapshot_Invalid(t *testing.T) {
+	_, err := RestoreOrderBook(bytes.NewReader([]byte("XXXX\x01")), &EmptyNotification{})
+	assert.Equal(t, ErrInvalidSnapshot, err)
+
+	_, ob := getTestOrderBook()
+	addDepth(ob, 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+
+	_, err = RestoreOrderBook(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), &EmptyNotification{})
+	assert.Error(t, err)
+}
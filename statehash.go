@@ -0,0 +1,106 @@
+package orderbook
+
+import (
+	decimal "github.com/geseq/udecimal"
+)
+
+// StateHash returns a hash of the resting orders, trigger orders and last
+// price of the book. Books that were fed the same token sequence have the same
+// hash, so replicas can compare hashes to detect that they diverged.
+//
+// The hash covers the ID, class, side, flag, quantity, displayed quantity,
+// price and trigger price of each order, including the market orders resting
+// in an auction. The position of an order within its
+// queue is not part of the hash. StateHash walks every order of the book
+// unless the book was created WithStateHash, which maintains the hash as
+// orders change and makes StateHash O(1).
+//
+// StateHash does not consume a token and must not be called concurrently with
+// any other method of the order book.
+func (ob *OrderBook) StateHash() uint64 {
+	h := mixHash(0, ob.bids.stateHash()+ob.bids.queueHash(&ob.marketBids))
+	h = mixHash(h, ob.asks.stateHash()+ob.asks.queueHash(&ob.marketAsks))
+	h = mixHash(h, ob.triggerOver.stateHash())
+	h = mixHash(h, ob.triggerUnder.stateHash())
+	return mixHash(h, ob.bids.bits.of(ob.lastPrice))
+}
+
+// stateHash returns the sum of the orderHash of every order in the level
+func (pl *priceLevel) stateHash() uint64 {
+	if pl.hashed {
+		return pl.hash
+	}
+
+	var h uint64
+	for it := pl.priceTree.Iterator(); it.Next(); {
+		for o := it.Value().Head(); o != nil; o = o.next {
+			h += pl.orderHash(o)
+		}
+	}
+	return h
+}
+
+// queueHash returns the sum of the orderHash of the orders of q, which is
+// not part of the level
+func (pl *priceLevel) queueHash(q *orderQueue) uint64 {
+	var h uint64
+	for o := q.Head(); o != nil; o = o.next {
+		h += pl.orderHash(o)
+	}
+	return h
+}
+
+// addHash adds o to the incrementally maintained hash of the level
+func (pl *priceLevel) addHash(o *Order) {
+	if pl.hashed {
+		pl.hash += pl.orderHash(o)
+	}
+}
+
+// subHash removes o from the incrementally maintained hash of the level
+func (pl *priceLevel) subHash(o *Order) {
+	if pl.hashed {
+		pl.hash -= pl.orderHash(o)
+	}
+}
+
+// mixHash combines x into the hash h
+func mixHash(h, x uint64) uint64 {
+	h ^= x
+	h ^= h >> 33
+	h *= fibHash
+	h ^= h >> 29
+	return h
+}
+
+// orderHash returns the contribution of o to the hash of the level. Levels
+// add the hashes of their orders so that the result does not depend on the
+// order in which they were added or removed.
+func (pl *priceLevel) orderHash(o *Order) uint64 {
+	h := mixHash(uint64(pl.priceType)+1, o.ID)
+	h = mixHash(h, uint64(o.Class)|uint64(o.Side)<<8|uint64(o.Flag)<<16)
+	h = mixHash(h, pl.bits.of(o.Qty))
+	h = mixHash(h, pl.bits.of(o.visibleQty))
+	h = mixHash(h, pl.bits.of(o.Price))
+	return mixHash(h, pl.bits.of(o.TrigPrice))
+}
+
+// decimalBits recovers the fixed point value of a decimal from its uvarint
+// encoding. It is kept in the price level so that no allocation is needed.
+type decimalBits struct {
+	x     uint64
+	shift uint
+}
+
+// WriteByte implements io.ByteWriter interface
+func (d *decimalBits) WriteByte(b byte) error {
+	d.x |= uint64(b&0x7f) << d.shift
+	d.shift += 7
+	return nil
+}
+
+func (d *decimalBits) of(v decimal.Decimal) uint64 {
+	d.x, d.shift = 0, 0
+	v.WriteTo(d)
+	return d.x
+}
@@ -0,0 +1,87 @@
+package orderbook
+
+import (
+	"bytes"
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateHash_Replicas(t *testing.T) {
+	_, ob := getTestOrderBook()
+	journalCommands(ob)
+
+	_, rob := getTestOrderBook()
+	journalCommands(rob)
+
+	assert.Equal(t, ob.StateHash(), rob.StateHash())
+
+	// Any difference in the resting orders changes the hash
+	h := ob.StateHash()
+	processLine(ob, "200	L	B	1	50	0	N")
+	assert.NotEqual(t, h, ob.StateHash())
+
+	var buf bytes.Buffer
+	require.NoError(t, ob.Snapshot(&buf))
+	restored, err := RestoreOrderBook(&buf, &EmptyNotification{})
+	require.NoError(t, err)
+	assert.Equal(t, ob.StateHash(), restored.StateHash())
+}
+
+func getHashedOrderBook() *OrderBook {
+	tok = 1
+	return NewOrderBook(&EmptyNotification{}, WithStateHash(true))
+}
+
+func TestStateHash_Incremental(t *testing.T) {
+	other := getHashedOrderBook()
+	empty := other.StateHash()
+	processLine(other, "2	L	B	2	90	0	N")
+	addIceberg(other, 1, Sell, 10, 3, 100)
+	other.ModifyOrder(tok, 2, decimal.New(5, 0), decimal.New(90, 0))
+	tok++
+	processLine(other, "3	L	B	1	120	110	SL")
+
+	// The same orders reached by a different path hash the same
+	ob := getHashedOrderBook()
+	addIceberg(ob, 1, Sell, 10, 3, 100)
+	processLine(ob, "2	L	B	5	90	0	N")
+	processLine(ob, "3	L	B	1	120	110	SL")
+	assert.Equal(t, other.StateHash(), ob.StateHash())
+
+	// Fills of an iceberg order update the hash of the level
+	h := ob.StateHash()
+	processLine(ob, "4	M	B	3	0	0	N") // @ LP 100
+	assert.NotEqual(t, h, ob.StateHash())
+
+	// Walking the book gives the same hash
+	_, walked := getTestOrderBook()
+	addIceberg(walked, 1, Sell, 10, 3, 100)
+	processLine(walked, "2	L	B	5	90	0	N")
+	processLine(walked, "3	L	B	1	120	110	SL")
+	processLine(walked, "4	M	B	3	0	0	N")
+	assert.Equal(t, ob.StateHash(), walked.StateHash())
+	assert.Zero(t, walked.bids.hash+walked.asks.hash)
+
+	ob.CancelOrder(tok, 1)
+	tok++
+	ob.CancelOrder(tok, 2)
+	tok++
+	ob.CancelOrder(tok, 3)
+	tok++
+	assert.NotEqual(t, empty, ob.StateHash())
+
+	last := getHashedOrderBook()
+	last.lastPrice = ob.lastPrice
+	assert.Equal(t, last.StateHash(), ob.StateHash())
+	assert.Zero(t, ob.bids.hash+ob.asks.hash+ob.triggerOver.hash+ob.triggerUnder.hash)
+}
+
+func TestStateHash_NoAllocs(t *testing.T) {
+	ob := getHashedOrderBook()
+	addDepth(ob, 0)
+
+	assert.Zero(t, testing.AllocsPerRun(100, func() { ob.StateHash() }))
+}
@@ -16,6 +16,12 @@ func (o OrderStatus) String() string {
 		return "FilledComplete"
 	case Accepted:
 		return "Accepted"
+	case Replenished:
+		return "Replenished"
+	case Decremented:
+		return "Decremented"
+	case Triggered:
+		return "Triggered"
 	}
 
 	return ""
@@ -27,4 +33,7 @@ const (
 	FilledPartial
 	FilledComplete
 	Accepted
+	Replenished
+	Decremented
+	Triggered
 )
@@ -0,0 +1,108 @@
+package orderbook
+
+import decimal "github.com/geseq/udecimal"
+
+// STPMode selects how self-trade prevention resolves a match between two
+// orders of the same owner
+type STPMode byte
+
+const (
+	// STPNone allows orders of the same owner to match
+	STPNone STPMode = iota
+	// STPCancelNewest cancels the remaining quantity of the incoming order
+	STPCancelNewest
+	// STPCancelOldest cancels the resting order and keeps matching
+	STPCancelOldest
+	// STPCancelBoth cancels both the resting order and the incoming order
+	STPCancelBoth
+	// STPDecrementCancel decrements both orders by the smaller quantity,
+	// canceling whichever order is left with nothing
+	STPDecrementCancel
+)
+
+// String implements fmt.Stringer interface
+func (m STPMode) String() string {
+	switch m {
+	case STPCancelNewest:
+		return "CancelNewest"
+	case STPCancelOldest:
+		return "CancelOldest"
+	case STPCancelBoth:
+		return "CancelBoth"
+	case STPDecrementCancel:
+		return "DecrementCancel"
+	default:
+		return "None"
+	}
+}
+
+// selfTrade describes how self-trade prevention treats the resting orders of
+// owner when the quantity a taker of owner can fill is worked out
+type selfTrade struct {
+	owner   uint64 // zero if no resting order is a self-trade
+	stop    bool   // the taker loses quantity at the first order of owner
+	byLevel bool   // ... before anything at the price of that order trades
+}
+
+// selfTrade returns how the resting orders of owner are resolved for a taker
+// of owner. Only STPCancelOldest lets the taker carry on past them unchanged;
+// every other mode cancels or decrements the taker, which then cannot be
+// filled entirely.
+func (ob *OrderBook) selfTrade(owner uint64) selfTrade {
+	if ob.stpMode == STPNone || owner == 0 {
+		return selfTrade{}
+	}
+
+	return selfTrade{
+		owner:   owner,
+		stop:    ob.stpMode != STPCancelOldest,
+		byLevel: ob.proRata != nil,
+	}
+}
+
+// preventSelfTrade resolves a match between a resting maker order and a taker
+// order of the same owner according to the configured STPMode, and returns the
+// quantity canceled from the taker. Every order affected is reported with a
+// MsgSelfTrade notification.
+func (ob *OrderBook) preventSelfTrade(pl *priceLevel, maker, taker *Order, qty decimal.Decimal) decimal.Decimal {
+	switch ob.stpMode {
+	case STPCancelOldest:
+		ob.cancelSelfTrade(maker)
+		return decimal.Zero
+	case STPCancelBoth:
+		ob.cancelSelfTrade(maker)
+		ob.putOrder(MsgSelfTrade, Canceled, taker, qty, decimal.Zero, ReasonSelfTrade, ErrSelfTrade)
+		return qty
+	case STPDecrementCancel:
+		dec := qty
+		if maker.Qty.LessThan(dec) {
+			dec = maker.Qty
+		}
+
+		if dec.Equal(maker.Qty) {
+			ob.cancelSelfTrade(maker)
+		} else {
+			pl.UpdateQty(maker, maker.Qty.Sub(dec))
+			ob.putOrder(MsgSelfTrade, Decremented, maker, dec, maker.Qty, ReasonSelfTrade, ErrSelfTrade)
+			ob.cancelExits(maker)
+		}
+
+		if dec.Equal(qty) {
+			ob.putOrder(MsgSelfTrade, Canceled, taker, dec, decimal.Zero, ReasonSelfTrade, ErrSelfTrade)
+		} else {
+			ob.putOrder(MsgSelfTrade, Decremented, taker, dec, qty.Sub(dec), ReasonSelfTrade, ErrSelfTrade)
+			ob.cancelExits(taker)
+		}
+		return dec
+	default:
+		ob.putOrder(MsgSelfTrade, Canceled, taker, qty, decimal.Zero, ReasonSelfTrade, ErrSelfTrade)
+		return qty
+	}
+}
+
+// cancelSelfTrade removes a resting order canceled by self-trade prevention
+func (ob *OrderBook) cancelSelfTrade(o *Order) {
+	ob.cancelOrder(o.ID)
+	ob.putOrder(MsgSelfTrade, Canceled, o, o.Qty, decimal.Zero, ReasonSelfTrade, ErrSelfTrade)
+	ob.release(o)
+}
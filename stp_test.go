@@ -0,0 +1,192 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func addOwnedOrder(ob *OrderBook, id uint64, side SideType, qty, price, owner uint64) {
+	ob.AddOrderWithAttrs(tok, id, Limit, side, decimal.New(qty, 0), decimal.New(price, 0), decimal.Zero, None, OrderAttrs{Owner: owner})
+	tok++
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode     STPMode
+		makerQty uint64
+		expected []string
+		resting  []uint64
+	}{
+		{
+			mode:     STPNone,
+			makerQty: 2,
+			expected: []string{
+				"1 3 FilledComplete FilledPartial 2 100",
+				"2 3 FilledPartial FilledComplete 1 100",
+			},
+			resting: []uint64{2},
+		},
+		{
+			mode:     STPCancelNewest,
+			makerQty: 2,
+			expected: []string{
+				"SelfTrade Canceled 3 3 ErrSelfTrade",
+			},
+			resting: []uint64{1, 2},
+		},
+		{
+			mode:     STPCancelOldest,
+			makerQty: 2,
+			expected: []string{
+				"SelfTrade Canceled 1 2 ErrSelfTrade",
+				"2 3 FilledComplete FilledPartial 2 100",
+			},
+			resting: []uint64{3},
+		},
+		{
+			mode:     STPCancelBoth,
+			makerQty: 2,
+			expected: []string{
+				"SelfTrade Canceled 1 2 ErrSelfTrade",
+				"SelfTrade Canceled 3 3 ErrSelfTrade",
+			},
+			resting: []uint64{2},
+		},
+		{
+			mode:     STPDecrementCancel,
+			makerQty: 2,
+			expected: []string{
+				"SelfTrade Canceled 1 2 ErrSelfTrade",
+				"SelfTrade Decremented 3 2 ErrSelfTrade",
+				"2 3 FilledPartial FilledComplete 1 100",
+			},
+			resting: []uint64{2},
+		},
+		{
+			mode:     STPDecrementCancel,
+			makerQty: 5,
+			expected: []string{
+				"SelfTrade Decremented 1 3 ErrSelfTrade",
+				"SelfTrade Canceled 3 3 ErrSelfTrade",
+			},
+			resting: []uint64{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			n := &Notification{}
+			ob := NewOrderBook(n, WithSelfTradePrevention(tt.mode))
+			tok = 1
+
+			addOwnedOrder(ob, 1, Sell, tt.makerQty, 100, 7)
+			addOwnedOrder(ob, 2, Sell, 2, 100, 8)
+			n.Reset()
+
+			addOwnedOrder(ob, 3, Buy, 3, 100, 7)
+
+			expected := append([]string{"CreateOrder Accepted 3 3"}, tt.expected...)
+			n.Verify(t, expected)
+
+			for _, id := range tt.resting {
+				assert.NotNil(t, ob.Order(id), "order %d should be resting", id)
+			}
+		})
+	}
+}
+
+func TestSelfTradePrevention_FoK(t *testing.T) {
+	tests := []struct {
+		mode     STPMode
+		class    ClassType
+		flag     FlagType
+		qty      uint64
+		expected []string
+	}{
+		{STPCancelOldest, Limit, FoK, 3, []string{
+			"CreateOrder Accepted 4 3",
+			"SelfTrade Canceled 1 2 ErrSelfTrade",
+			"2 4 FilledComplete FilledPartial 2 100",
+			"3 4 FilledPartial FilledComplete 1 101",
+		}},
+		{STPCancelOldest, Limit, FoK, 5, []string{
+			"CreateOrder Rejected 4 5 ErrNotFillable",
+		}},
+		{STPCancelOldest, Market, AoN, 5, []string{
+			"CreateOrder Rejected 4 5 ErrNotFillable",
+		}},
+		{STPCancelNewest, Limit, FoK, 3, []string{
+			"CreateOrder Rejected 4 3 ErrNotFillable",
+		}},
+		{STPDecrementCancel, Limit, FoK, 3, []string{
+			"CreateOrder Rejected 4 3 ErrNotFillable",
+		}},
+		{STPDecrementCancel, Market, AoN, 3, []string{
+			"CreateOrder Rejected 4 3 ErrNotFillable",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			n := &Notification{}
+			ob := NewOrderBook(n, WithSelfTradePrevention(tt.mode))
+			tok = 1
+
+			addOwnedOrder(ob, 1, Sell, 2, 100, 7)
+			addOwnedOrder(ob, 2, Sell, 2, 100, 8)
+			addOwnedOrder(ob, 3, Sell, 2, 101, 8)
+			n.Reset()
+
+			// Quantity of the same owner is never filled, so it does not count
+			price := decimal.New(101, 0)
+			if tt.class == Market {
+				price = decimal.Zero
+			}
+			ob.AddOrderWithAttrs(tok, 4, tt.class, Buy, decimal.New(tt.qty, 0), price, decimal.Zero, tt.flag, OrderAttrs{Owner: 7})
+			tok++
+
+			n.Verify(t, tt.expected)
+		})
+	}
+}
+
+func TestSelfTradePrevention_NoOwner(t *testing.T) {
+	n := &Notification{}
+	ob := NewOrderBook(n, WithSelfTradePrevention(STPCancelBoth))
+	tok = 1
+
+	addOwnedOrder(ob, 1, Sell, 2, 100, 0)
+	addOwnedOrder(ob, 2, Buy, 2, 100, 0)
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 1 2",
+		"CreateOrder Accepted 2 2",
+		"1 2 FilledComplete FilledComplete 2 100",
+	})
+}
+
+func TestSelfTradePrevention_BracketEntry(t *testing.T) {
+	n := &Notification{}
+	ob := NewOrderBook(n, WithSelfTradePrevention(STPCancelNewest))
+	tok = 1
+
+	addOwnedOrder(ob, 1, Sell, 2, 100, 7)
+	addOwnedOrder(ob, 20, Buy, 2, 95, 7)
+	addLinkedOrder(ob, 21, Limit, Sell, 2, 120, 0, None, 0, 20)
+	n.Reset()
+
+	// The entry is canceled by self-trade prevention, not filled
+	ob.ModifyOrder(tok, 20, decimal.New(2, 0), decimal.New(100, 0))
+	tok++
+
+	n.Verify(t, []string{
+		"ModifyOrder Accepted 20 2",
+		"SelfTrade Canceled 20 2 ErrSelfTrade",
+		"CancelOrder Canceled 21 2 ErrLinkedOrder",
+	})
+	assert.Nil(t, ob.Order(21))
+	assert.True(t, ob.held.Empty())
+	assert.Equal(t, uint64(1), ob.asks.Len())
+}
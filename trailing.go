@@ -0,0 +1,112 @@
+package orderbook
+
+import (
+	local_tree "github.com/geseq/orderbook/pkg/tree"
+	decimal "github.com/geseq/udecimal"
+)
+
+// TrailType selects how the offset of a trailing stop order is applied
+type TrailType byte
+
+const (
+	// TrailNone is a regular stop order with a fixed trigger price
+	TrailNone TrailType = iota
+	// TrailAbsolute keeps the trigger price TrailOffset away from the best
+	// price seen since the order was placed
+	TrailAbsolute
+	// TrailPercent keeps the trigger price a fraction TrailOffset of the best
+	// price seen since the order was placed, e.g. 0.05 for 5%
+	TrailPercent
+)
+
+// String implements fmt.Stringer interface
+func (t TrailType) String() string {
+	switch t {
+	case TrailAbsolute:
+		return "TrailAbsolute"
+	case TrailPercent:
+		return "TrailPercent"
+	default:
+		return "TrailNone"
+	}
+}
+
+// trailPrice returns the trigger price of a trailing stop on the given side
+// for the reference price ref, rounded to the tick size away from ref. ok is
+// false if the offset leaves no valid price below ref.
+func (ob *OrderBook) trailPrice(side SideType, ref decimal.Decimal, attrs *OrderAttrs) (p decimal.Decimal, ok bool) {
+	offset := attrs.TrailOffset
+	if attrs.TrailType == TrailPercent {
+		offset = ref.Mul(offset)
+	}
+
+	if side == Buy {
+		return ob.inst.ceil(ref.Add(offset)), true
+	}
+
+	if offset.GreaterThanOrEqual(ref) {
+		return decimal.Zero, false
+	}
+	p = ob.inst.floor(ref.Sub(offset))
+	return p, !p.IsZero()
+}
+
+func newTrailingTree(poolSize uint64) *local_tree.Tree[uint64, *Order] {
+	return local_tree.NewWithPool(Uint64Cmp, local_tree.NewNodePool[uint64, *Order](poolSize))
+}
+
+// adjustTrailingStops moves the trigger price of trailing stops after the
+// last price. The trigger of a sell stop only ever moves up and that of a buy
+// stop only ever moves down. The limit price of a trailing stop limit order
+// moves by the same amount so the distance to the trigger is kept.
+//
+// Only the trailing stops of the trigger levels are visited. They are
+// repositioned in ID order so the resulting queue order is deterministic.
+func (ob *OrderBook) adjustTrailingStops() {
+	ob.adjustTrailing(ob.triggerUnder, Sell)
+	ob.adjustTrailing(ob.triggerOver, Buy)
+}
+
+func (ob *OrderBook) adjustTrailing(pl *priceLevel, side SideType) {
+	if pl.trailing.Empty() {
+		return
+	}
+
+	moved := ob.trailing[:0]
+	for it := pl.trailing.Iterator(); it.Next(); {
+		o := it.Value()
+		if o.Side != side {
+			continue
+		}
+
+		p, ok := ob.trailPrice(side, ob.lastPrice, o.OrderAttrs)
+		if !ok {
+			continue
+		}
+
+		if (side == Sell && p.GreaterThan(o.TrigPrice)) || (side == Buy && p.LessThan(o.TrigPrice)) {
+			moved = append(moved, o)
+		}
+	}
+
+	for _, o := range moved {
+		p, _ := ob.trailPrice(side, ob.lastPrice, o.OrderAttrs)
+		pl.Remove(o)
+
+		if o.Class == Limit {
+			if side == Sell {
+				o.Price = ob.inst.floor(o.Price.Add(p.Sub(o.TrigPrice)))
+			} else if delta := o.TrigPrice.Sub(p); delta.LessThan(o.Price) {
+				o.Price = ob.inst.ceil(o.Price.Sub(delta))
+			}
+		}
+
+		o.TrigPrice = p
+		pl.Append(o)
+	}
+
+	for i := range moved {
+		moved[i] = nil
+	}
+	ob.trailing = moved[:0]
+}
@@ -0,0 +1,105 @@
+package orderbook
+
+import (
+	"testing"
+
+	decimal "github.com/geseq/udecimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func addTrailingStop(ob *OrderBook, id uint64, class ClassType, side SideType, qty, price uint64, trail TrailType, offset decimal.Decimal) {
+	ob.AddOrderWithAttrs(tok, id, class, side, decimal.New(qty, 0), decimal.New(price, 0), decimal.Zero, StopLoss, OrderAttrs{
+		TrailType:   trail,
+		TrailOffset: offset,
+	})
+	tok++
+}
+
+func TestTrailingStop_Absolute(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	10	90	0	N")
+	processLine(ob, "2	L	S	10	100	0	N")
+	processLine(ob, "3	L	S	10	105	0	N")
+	processLine(ob, "4	M	B	1	0	0	N") // @ LP 100
+	n.Reset()
+
+	addTrailingStop(ob, 10, Market, Sell, 2, 0, TrailAbsolute, decimal.New(5, 0))
+	assert.Equal(t, decimal.New(95, 0), ob.Order(10).TrigPrice)
+	assert.Equal(t, 1, ob.triggerUnder.trailing.Size())
+
+	processLine(ob, "5	M	B	10	0	0	N") // @ LP 105
+	assert.Equal(t, decimal.New(100, 0), ob.Order(10).TrigPrice)
+	assert.Equal(t, decimal.New(100, 0), ob.triggerUnder.MaxPriceQueue().Price())
+
+	// The trigger never moves back down
+	processLine(ob, "6	L	B	1	102	0	N")
+	processLine(ob, "7	M	S	1	0	0	N") // @ LP 102
+	assert.Equal(t, decimal.New(100, 0), ob.Order(10).TrigPrice)
+
+	processLine(ob, "8	L	S	1	90	0	N") // @ LP 90
+	assert.Nil(t, ob.Order(10))
+	assert.True(t, ob.triggerUnder.trailing.Empty())
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 5 10",
+		"2 5 FilledComplete FilledPartial 9 100",
+		"3 5 FilledPartial FilledComplete 1 105",
+		"CreateOrder Accepted 6 1",
+		"CreateOrder Accepted 7 1",
+		"6 7 FilledComplete FilledComplete 1 102",
+		"CreateOrder Accepted 8 1",
+		"1 8 FilledPartial FilledComplete 1 90",
+		"CreateOrder Triggered 10 2",
+		"1 10 FilledPartial FilledComplete 2 90",
+	})
+}
+
+func TestTrailingStop_PercentLimit(t *testing.T) {
+	n, ob := getTestOrderBook()
+	processLine(ob, "1	L	B	10	90	0	N")
+	processLine(ob, "2	L	B	10	100	0	N")
+	processLine(ob, "3	M	S	1	0	0	N") // @ LP 100
+	n.Reset()
+
+	addTrailingStop(ob, 10, Limit, Buy, 2, 112, TrailPercent, decimal.New(1, -1))
+	assert.Equal(t, decimal.New(110, 0), ob.Order(10).TrigPrice)
+
+	processLine(ob, "4	M	S	10	0	0	N") // @ LP 90
+	assert.Equal(t, decimal.New(99, 0), ob.Order(10).TrigPrice)
+	assert.Equal(t, decimal.New(101, 0), ob.Order(10).Price)
+
+	processLine(ob, "5	L	S	5	99	0	N")
+	processLine(ob, "6	M	B	1	0	0	N") // @ LP 99
+	assert.Nil(t, ob.Order(10))
+
+	n.Verify(t, []string{
+		"CreateOrder Accepted 10 2",
+		"CreateOrder Accepted 4 10",
+		"2 4 FilledComplete FilledPartial 9 100",
+		"1 4 FilledPartial FilledComplete 1 90",
+		"CreateOrder Accepted 5 5",
+		"CreateOrder Accepted 6 1",
+		"5 6 FilledPartial FilledComplete 1 99",
+		"CreateOrder Triggered 10 2",
+		"5 10 FilledPartial FilledComplete 2 99",
+	})
+}
+
+func TestTrailingStop_Invalid(t *testing.T) {
+	n, ob := getTestOrderBook()
+
+	addTrailingStop(ob, 1, Market, Sell, 1, 0, TrailAbsolute, decimal.New(5, 0))
+	addTrailingStop(ob, 2, Market, Sell, 1, 0, TrailAbsolute, decimal.Zero)
+	ob.AddOrderWithAttrs(tok, 3, Limit, Sell, decimal.New(1, 0), decimal.New(100, 0), decimal.Zero, None, OrderAttrs{
+		TrailType:   TrailAbsolute,
+		TrailOffset: decimal.New(5, 0),
+	})
+	tok++
+
+	n.Verify(t, []string{
+		"CreateOrder Rejected 1 1 ErrInvalidTriggerPrice",
+		"CreateOrder Rejected 2 1 ErrInvalidTrail",
+		"CreateOrder Rejected 3 1 ErrInvalidTrail",
+	})
+}
@@ -18,20 +18,66 @@ type SideType byte
 // FlagType of the order
 type FlagType byte
 
+// OrderAttrs holds the optional attributes of an order
+type OrderAttrs struct {
+	// DisplayQty is the visible peak size of an iceberg order. The remaining
+	// quantity is held in reserve and replenishes the peak when it is filled.
+	// Zero means the whole quantity is visible. AoN orders cannot have one.
+	DisplayQty decimal.Decimal `json:"displayQty" `
+
+	// Owner identifies the account the order belongs to. Orders with the same
+	// non-zero owner are subject to self-trade prevention.
+	Owner uint64 `json:"owner" `
+
+	// TIF is the time in force of the order. GTD orders expire at ExpireAt
+	// and DAY orders at the next session close, both measured against the
+	// clock advanced by OrderBook.AdvanceTime.
+	TIF      TimeInForce `json:"tif" `
+	ExpireAt int64       `json:"expireAt" `
+
+	// TrailType makes a stop loss order a trailing stop. Its trigger price
+	// follows the last price at a distance of TrailOffset.
+	TrailType   TrailType       `json:"trailType" `
+	TrailOffset decimal.Decimal `json:"trailOffset" `
+
+	// Group links the order with all other orders of the same non-zero
+	// group (one-cancels-other). As soon as one of them fills or triggers
+	// the others are canceled.
+	Group uint64 `json:"group" `
+
+	// Parent makes the order an exit of a bracket. It is held inactive until
+	// the entry order with ID Parent is filled entirely and canceled if the
+	// entry leaves the book before that.
+	Parent uint64 `json:"parent" `
+}
+
 // Order strores information about request
 type Order struct {
 	ID        uint64          `json:"id" `
 	Class     ClassType       `json:"class" `
 	Side      SideType        `json:"side" `
 	Flag      FlagType        `json:"flag" `
+	canceled  bool            // leg of a fired OCO group waiting to be canceled
 	Qty       decimal.Decimal `json:"qty" `
 	Price     decimal.Decimal `json:"price" `
 	TrigPrice decimal.Decimal `json:"trigPrice" `
-	queue     *orderQueue
-	prev      *Order
-	next      *Order
+
+	// The optional attributes are kept out of line since most orders do not
+	// use them. Orders of a book without attributes share a read-only zero
+	// value, so they must not be modified.
+	*OrderAttrs
+
+	visibleQty decimal.Decimal
+	filledQty  decimal.Decimal
+	queue      *orderQueue
+	prev       *Order
+	next       *Order
+	pools      *Pools // pools the order is released to
 }
 
+// noAttrs is shared by the orders of a book that have no optional attributes
+var noAttrs OrderAttrs
+
 // Trade strores information about request
 type Trade struct {
 	MakerOrderID uint64          `json:"makerOrderId" `